@@ -0,0 +1,284 @@
+package termads
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	ADS_API_URL       = `https://api.adsabs.harvard.edu/v1/search/query`
+	ADS_UI_URL        = `https://ui.adsabs.harvard.edu`
+	ADS_API_FIELDS    = `bibcode,title,author,aff,orcid_pub,abstract,pubdate,bibstem,volume,page,doi,identifier,keyword,citation_count,read_count,score,esources,data,[citations]`
+	ADS_API_TOKEN_ENV = `ADS_API_TOKEN`
+)
+
+/*=======================================================
+/*                 ADS v1 JSON API
+/*=======================================================*/
+
+type apiResponse struct {
+	Response struct {
+		NumFound int      `json:"numFound"`
+		Start    int      `json:"start"`
+		Docs     []apiDoc `json:"docs"`
+	} `json:"response"`
+	Error *struct {
+		Msg  string `json:"msg"`
+		Code int    `json:"code"`
+	} `json:"error"`
+}
+
+type apiDoc struct {
+	Bibcode       string   `json:"bibcode"`
+	Title         []string `json:"title"`
+	Author        []string `json:"author"`
+	Aff           []string `json:"aff"`
+	ORCID         []string `json:"orcid_pub"`
+	Abstract      string   `json:"abstract"`
+	Pubdate       string   `json:"pubdate"`
+	Bibstem       []string `json:"bibstem"`
+	Volume        string   `json:"volume"`
+	Page          []string `json:"page"`
+	DOI           []string `json:"doi"`
+	Identifier    []string `json:"identifier"`
+	Keyword       []string `json:"keyword"`
+	CitationCount int      `json:"citation_count"`
+	ReadCount     int      `json:"read_count"`
+	Score         float64  `json:"score"`
+	Esources      []string `json:"esources"`
+	Data          []string `json:"data"`
+	Citations     struct {
+		NumCitations  int `json:"num_citations"`
+		NumReferences int `json:"num_references"`
+	} `json:"[citations]"`
+}
+
+// APIToken returns the token stored in $ADS_API_TOKEN.
+func APIToken() string {
+	return os.Getenv(ADS_API_TOKEN_ENV)
+}
+
+func (client *Client) papersFromAPIResponse(body *apiResponse) []Paper {
+	papers := make([]Paper, 0, len(body.Response.Docs))
+	for _, doc := range body.Response.Docs {
+		papers = append(papers, doc.paper(client))
+	}
+	return papers
+}
+
+func (doc *apiDoc) paper(client *Client) Paper {
+	p := client.NewPaper()
+	meta := p.Metadata()
+	for i, name := range doc.Author {
+		author := ParseAuthor(name)
+		if i < len(doc.Aff) {
+			author.Affiliation = doc.Aff[i]
+		}
+		if i < len(doc.ORCID) && doc.ORCID[i] != `-` {
+			author.ORCID = doc.ORCID[i]
+		}
+		meta.Authors = append(meta.Authors, author)
+	}
+	meta.SetPubDate(doc.Pubdate)
+	if len(doc.Bibstem) > 0 {
+		meta.Bibstem = doc.Bibstem[0]
+	}
+	meta.Volume = doc.Volume
+	if len(doc.Page) > 0 {
+		meta.Page = doc.Page[0]
+	}
+	if len(doc.DOI) > 0 {
+		meta.DOI = doc.DOI[0]
+	}
+	for _, id := range doc.Identifier {
+		if strings.HasPrefix(strings.ToLower(id), `arxiv:`) {
+			meta.ArXivID = id[len(`arxiv:`):]
+		}
+	}
+	meta.Keywords = doc.Keyword
+	meta.CitationCount = doc.CitationCount
+	meta.ReadCount = doc.ReadCount
+	meta.Score = doc.Score
+	p.SetBibcode(doc.Bibcode)
+	p.SetTitle(strings.Join(doc.Title, ` `))
+	p.SetAbstract(doc.Abstract)
+
+	abs := ADS_UI_URL + `/abs/` + url.PathEscape(doc.Bibcode)
+	gateway := ADS_UI_URL + `/link_gateway/` + url.PathEscape(doc.Bibcode)
+	p.SetURL(abs+`/abstract`, LINKTYPE_ABSTRACT)
+	if doc.CitationCount > 0 || doc.Citations.NumCitations > 0 {
+		p.SetURL(abs+`/citations`, LINKTYPE_CITATIONS)
+	}
+	if doc.Citations.NumReferences > 0 {
+		p.SetURL(abs+`/references`, LINKTYPE_REFERENCES)
+	}
+	if len(doc.Data) > 0 {
+		p.SetURL(abs+`/data`, LINKTYPE_ONLINE_DATA)
+	}
+	for _, esource := range doc.Esources {
+		switch esource {
+		case `PUB_HTML`:
+			p.SetURL(gateway+`/`+esource, LINKTYPE_ELEC_ARTICLE)
+		case `PUB_PDF`:
+			p.SetURL(gateway+`/`+esource, LINKTYPE_FULL_ARTICLE)
+		case `ADS_SCAN`:
+			p.SetURL(gateway+`/`+esource, LINKTYPE_GIF)
+		case `EPRINT_PDF`:
+			p.SetURL(gateway+`/`+esource, LINKTYPE_ARXIV)
+		}
+	}
+	return p
+}
+
+/*=======================================================
+/*               Form -> ADS query string
+/*=======================================================*/
+
+// Query translates the legacy form fields into the ADS search syntax.
+func (form *Form) Query() string {
+	terms := []string{}
+	if q := fieldQuery(`author`, splitAuthors(form.values[`author`]), form.values.Get(`aut_logic`)); q != `` {
+		terms = append(terms, q)
+	}
+	if q := fieldQuery(`object`, splitAuthors(form.values[`object`]), form.values.Get(`obj_logic`)); q != `` {
+		terms = append(terms, q)
+	}
+	if q := fieldQuery(`title`, splitWords(form.values[`title`]), form.values.Get(`ttl_logic`)); q != `` {
+		terms = append(terms, q)
+	}
+	if q := fieldQuery(`abs`, splitWords(form.values[`text`]), form.values.Get(`txt_logic`)); q != `` {
+		terms = append(terms, q)
+	}
+	if q := form.dateQuery(); q != `` {
+		terms = append(terms, q)
+	}
+	if q := fieldQuery(`bibstem`, strings.Split(form.values.Get(`ref_stems`), `,`), `OR`); form.values.Get(`ref_stems`) != `` {
+		terms = append(terms, q)
+	}
+	switch form.values.Get(`jou_pick`) {
+	case `NO`:
+		terms = append(terms, `property:refereed`)
+	case `EXCL`:
+		terms = append(terms, `property:notrefereed`)
+	}
+	if form.query != nil {
+		if b, ok := form.query.(*Bool); ok && b.Op == OP_OR && len(terms) > 0 {
+			terms = append(terms, `(`+b.String()+`)`)
+		} else {
+			terms = append(terms, form.query.String())
+		}
+	}
+	if len(terms) == 0 {
+		return `*:*`
+	}
+	return strings.Join(terms, ` AND `)
+}
+
+// APIValues returns the query parameters of /search/query for the form.
+func (form *Form) APIValues() url.Values {
+	values := url.Values{}
+	values.Set(`q`, form.Query())
+	values.Set(`fl`, ADS_API_FIELDS)
+	if rows, err := strconv.Atoi(form.values.Get(`nr_to_return`)); err == nil && rows > 0 {
+		values.Set(`rows`, strconv.Itoa(rows))
+	}
+	if start, err := strconv.Atoi(form.values.Get(`start_nr`)); err == nil && start > 1 {
+		values.Set(`start`, strconv.Itoa(start-1))
+	}
+	switch form.values.Get(`sort`) {
+	case `DATE`:
+		values.Set(`sort`, `date desc`)
+	case `CITATIONS`:
+		values.Set(`sort`, `citation_count desc`)
+	default:
+		values.Set(`sort`, `score desc`)
+	}
+	return values
+}
+
+func (form *Form) dateQuery() string {
+	start := apiDate(form.values.Get(`start_year`), form.values.Get(`start_mon`), `01`)
+	end := apiDate(form.values.Get(`end_year`), form.values.Get(`end_mon`), `12`)
+	if start == `*` && end == `*` {
+		return ``
+	}
+	return fmt.Sprintf(`pubdate:[%s TO %s]`, start, end)
+}
+
+func apiDate(year, month, defaultMonth string) string {
+	y, err := strconv.Atoi(strings.TrimSpace(year))
+	if err != nil || y <= 0 {
+		return `*`
+	}
+	m, err := strconv.Atoi(strings.TrimSpace(month))
+	if err != nil || m < 1 || m > 12 {
+		return fmt.Sprintf(`%04d-%s`, y, defaultMonth)
+	}
+	return fmt.Sprintf(`%04d-%02d`, y, m)
+}
+
+func fieldQuery(field string, terms []string, logic string) string {
+	if len(terms) == 0 {
+		return ``
+	}
+	if logic != `AND` {
+		logic = `OR`
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = quoteTerm(term)
+	}
+	if len(quoted) == 1 {
+		return field + `:` + quoted[0]
+	}
+	return field + `:(` + strings.Join(quoted, ` `+logic+` `) + `)`
+}
+
+func quoteTerm(term string) string {
+	if strings.ContainsAny(term, " \t,:()\"") {
+		return `"` + strings.Replace(term, `"`, `\"`, -1) + `"`
+	}
+	return term
+}
+
+// The legacy form separates authors by newlines or semicolons.
+func splitAuthors(values []string) []string {
+	authors := []string{}
+	for _, val := range values {
+		for _, author := range strings.FieldsFunc(val, func(r rune) bool { return r == ';' || r == '\n' }) {
+			if author = strings.TrimSpace(author); author != `` {
+				authors = append(authors, author)
+			}
+		}
+	}
+	return authors
+}
+
+// splitWords splits on whitespace, keeping "quoted phrases" together.
+func splitWords(values []string) []string {
+	words := []string{}
+	for _, val := range values {
+		word := []rune{}
+		quoted := false
+		for _, r := range val {
+			switch {
+			case r == '"':
+				quoted = !quoted
+			case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+				if len(word) > 0 {
+					words = append(words, string(word))
+					word = word[:0]
+				}
+			default:
+				word = append(word, r)
+			}
+		}
+		if len(word) > 0 {
+			words = append(words, string(word))
+		}
+	}
+	return words
+}
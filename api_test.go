@@ -0,0 +1,263 @@
+package termads
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+// apiServer serves body with status for every request and records the
+// query of the last one.
+func apiServer(t *testing.T, status int, body []byte, header http.Header) (*httptest.Server, *url.Values) {
+	t.Helper()
+	query := &url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*query = r.URL.Query()
+		if r.Header.Get(`Authorization`) != `Bearer test-token` {
+			t.Errorf(`Authorization = %q, want the bearer token`, r.Header.Get(`Authorization`))
+		}
+		for key, vals := range header {
+			w.Header()[key] = vals
+		}
+		w.Header().Set(`Content-Type`, `application/json`)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, query
+}
+
+func apiClient(server *httptest.Server) *Client {
+	client := NewClient()
+	client.APIURL = server.URL + `/v1/search/query`
+	client.Token = `test-token`
+	client.Limiter = nil
+	client.Retry = nil
+	return client
+}
+
+func TestAPIValues(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join(`testdata`, `api_search_kennicutt.json`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		form func(*Form)
+		want map[string]string
+	}{
+		{
+			name: `defaults`,
+			form: func(*Form) {},
+			want: map[string]string{`q`: `*:*`, `rows`: `200`, `start`: ``, `sort`: `score desc`},
+		},
+		{
+			name: `authors and years`,
+			form: func(form *Form) {
+				form.SetAuthor("Kennicutt, R.;Evans, N.")
+				form.SetStartDate(`1998`, ``)
+				form.SetEndDate(`2012`, `9`)
+			},
+			want: map[string]string{
+				`q`: `author:("Kennicutt, R." OR "Evans, N.") AND pubdate:[1998-01 TO 2012-09]`,
+			},
+		},
+		{
+			name: `title words with AND, refereed only`,
+			form: func(form *Form) {
+				form.SetTitle(`"star formation" law`)
+				form.SetSearchLogic(`title`, `AND`)
+				form.Set(`jou_pick`, `NO`)
+			},
+			want: map[string]string{`q`: `title:("star formation" AND law) AND property:refereed`},
+		},
+		{
+			name: `abstract words, journals`,
+			form: func(form *Form) {
+				form.SetText(`dust`)
+				form.Set(`ref_stems`, `ApJ,MNRAS`)
+			},
+			want: map[string]string{`q`: `abs:dust AND bibstem:(ApJ OR MNRAS)`},
+		},
+		{
+			name: `page and sort`,
+			form: func(form *Form) {
+				form.SetPage(201, 50)
+				form.Set(`sort`, `CITATIONS`)
+			},
+			want: map[string]string{`rows`: `50`, `start`: `200`, `sort`: `citation_count desc`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, query := apiServer(t, http.StatusOK, body, nil)
+			form := NewForm()
+			tt.form(form)
+			if _, _, err := apiClient(server).GetPage(form); err != nil {
+				t.Fatal(err)
+			}
+			if got := query.Get(`fl`); got != ADS_API_FIELDS {
+				t.Errorf(`fl = %q, want %q`, got, ADS_API_FIELDS)
+			}
+			for key, want := range tt.want {
+				if got := query.Get(key); got != want {
+					t.Errorf(`%s = %q, want %q`, key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPageFromAPI(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join(`testdata`, `api_search_kennicutt.json`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := apiServer(t, http.StatusOK, body, nil)
+	papers, total, err := apiClient(server).GetPage(NewForm())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 412 {
+		t.Errorf(`total = %d, want 412`, total)
+	}
+	if len(papers) != 2 {
+		t.Fatalf(`got %d papers, want 2`, len(papers))
+	}
+
+	p := papers[0]
+	meta := p.Metadata()
+	checks := []struct {
+		field     string
+		got, want interface{}
+	}{
+		{`bibcode`, p.GetBibcode(), `1998ApJ...498..541K`},
+		{`title`, p.GetTitle(), `The Global Schmidt Law in Star-forming Galaxies`},
+		{`authors`, len(meta.Authors), 1},
+		{`last name`, meta.Authors[0].Last, `Kennicutt`},
+		{`affiliation`, meta.Authors[0].Affiliation, `Steward Observatory, University of Arizona, Tucson, AZ 85721`},
+		{`orcid`, meta.Authors[0].ORCID, ``},
+		{`year`, meta.Year, 1998},
+		{`month`, meta.Month, 5},
+		{`bibstem`, meta.Bibstem, `ApJ`},
+		{`volume`, meta.Volume, `498`},
+		{`page`, meta.Page, `541`},
+		{`doi`, meta.DOI, `10.1086/305588`},
+		{`arxiv`, meta.ArXivID, `astro-ph/9712213`},
+		{`keywords`, len(meta.Keywords), 3},
+		{`citations`, meta.CitationCount, 5402},
+		{`reads`, meta.ReadCount, 912},
+		{`links`, p.LinkTypes(), `ACEFRX`},
+		{`abstract link`, p.GetURLOfType(LINKTYPE_ABSTRACT), ADS_UI_URL + `/abs/1998ApJ...498..541K/abstract`},
+		{`pdf link`, p.GetURLOfType(LINKTYPE_FULL_ARTICLE), ADS_UI_URL + `/link_gateway/1998ApJ...498..541K/PUB_PDF`},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf(`%s = %v, want %v`, c.field, c.got, c.want)
+		}
+	}
+	if p.GetAbstract() == `` {
+		t.Error(`abstract is empty`)
+	}
+
+	p = papers[1]
+	if got := p.Metadata().Authors[1].ORCID; got != `0000-0001-5175-1777` {
+		t.Errorf(`orcid of the second author = %q`, got)
+	}
+	if got := p.LinkTypes(); got != `ACDX` {
+		t.Errorf(`links = %q, want ACDX`, got)
+	}
+}
+
+func TestGetPageFromAPIErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		header http.Header
+		want   error
+	}{
+		{
+			name:   `unauthorized`,
+			status: http.StatusUnauthorized,
+			body:   `{"error": "Unauthorized"}`,
+			want:   ErrUnauthorized,
+		},
+		{
+			name:   `rate limited`,
+			status: http.StatusTooManyRequests,
+			body:   `{"error": {"msg": "Too many requests", "code": 429}}`,
+			header: http.Header{
+				`X-Ratelimit-Limit`:     {`5000`},
+				`X-Ratelimit-Remaining`: {`0`},
+				`X-Ratelimit-Reset`:     {`1924992000`},
+			},
+			want: ErrRateLimited,
+		},
+		{
+			name:   `not json`,
+			status: http.StatusOK,
+			body:   `<html>maintenance</html>`,
+			want:   ErrParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := apiServer(t, tt.status, []byte(tt.body), tt.header)
+			client := apiClient(server)
+			papers, _, err := client.GetPage(NewForm())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf(`err = %v, want %v`, err, tt.want)
+			}
+			if papers != nil {
+				t.Errorf(`got %d papers with the error`, len(papers))
+			}
+			var serr *StatusError
+			if tt.status != http.StatusOK && (!errors.As(err, &serr) || serr.Code != tt.status) {
+				t.Errorf(`err = %#v, want a *StatusError with code %d`, err, tt.status)
+			}
+		})
+	}
+}
+
+func TestAPIQuotaExhausted(t *testing.T) {
+	server, _ := apiServer(t, http.StatusTooManyRequests, []byte(`{}`), http.Header{
+		`X-Ratelimit-Limit`:     {`5000`},
+		`X-Ratelimit-Remaining`: {`0`},
+		`X-Ratelimit-Reset`:     {`1924992000`},
+	})
+	client := apiClient(server)
+	client.GetPage(NewForm())
+	if q := client.Quota(); q.Limit != 5000 || !q.Exhausted() {
+		t.Fatalf(`quota = %+v, want exhausted of 5000`, q)
+	}
+	// no request is made until the reset
+	server.Close()
+	if _, _, err := client.GetPage(NewForm()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf(`err = %v, want ErrRateLimited`, err)
+	}
+}
+
+func TestGetPaperFromAPI(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join(`testdata`, `api_search_kennicutt.json`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, query := apiServer(t, http.StatusOK, body, nil)
+	paper, err := apiClient(server).GetPaper(`1998ApJ...498..541K`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paper.GetBibcode(); got != `1998ApJ...498..541K` {
+		t.Errorf(`bibcode = %q`, got)
+	}
+	for key, want := range map[string]string{`q`: `bibcode:1998ApJ...498..541K`, `rows`: `1`, `start`: ``} {
+		if got := query.Get(key); got != want {
+			t.Errorf(`%s = %q, want %q`, key, got, want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package termads
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*=======================================================
+/*                    Bibcode
+/*=======================================================*/
+
+// Bibcode is the 19-character ADS identifier YYYYJJJJJVVVVMPPPPA:
+// year, journal abbreviation (left-justified), volume and page
+// (right-justified, padded with dots), qualifier and first-author initial.
+type Bibcode struct {
+	Year      int
+	Journal   string
+	Volume    string
+	Qualifier string
+	Page      string
+	Initial   string
+}
+
+const BIBCODE_LENGTH int = 19
+
+var (
+	// inner dots are part of legacy preprint bibcodes such as
+	// 2003astro.ph..1234X or 1998gr.qc.....1234X
+	bibcodeJournalPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9&.]*$`)
+	bibcodeFieldPattern   = regexp.MustCompile(`^[A-Za-z0-9&.]*$`)
+	looseBibcodePattern   = regexp.MustCompile(`^(\d{4})([A-Za-z][A-Za-z&]{0,4})\.*(\d{1,4})\.*([A-Za-z]?)\.*(\d{1,5})([A-Za-z.:])$`)
+)
+
+// ParseBibcode parses a bibcode. Besides the canonical form it accepts
+// spaces or missing padding, e.g. "2019ApJ 870 1S" or "2019ApJ.870.L1S".
+func ParseBibcode(s string) (Bibcode, error) {
+	s = strings.TrimSpace(strings.Replace(s, `%26`, `&`, -1))
+	if len(s) == BIBCODE_LENGTH && !strings.Contains(s, ` `) {
+		return parseCanonicalBibcode(s)
+	}
+	m := looseBibcodePattern.FindStringSubmatch(strings.Replace(s, ` `, `.`, -1))
+	if m == nil {
+		return Bibcode{}, &FieldError{Field: `bibcode`, Value: s, Reason: fmt.Sprintf(`must be %d characters`, BIBCODE_LENGTH)}
+	}
+	year, _ := strconv.Atoi(m[1])
+	return NewBibcode(year, m[2], m[3], m[4], m[5], m[6])
+}
+
+func parseCanonicalBibcode(s string) (Bibcode, error) {
+	year, err := strconv.Atoi(s[0:4])
+	if err != nil {
+		return Bibcode{}, &FieldError{Field: `bibcode`, Value: s, Reason: fmt.Sprintf(`year "%s" is not a number`, s[0:4])}
+	}
+	b := Bibcode{
+		Year:    year,
+		Journal: strings.TrimRight(s[4:9], `.`),
+		Volume:  strings.TrimLeft(s[9:13], `.`),
+		Page:    strings.TrimLeft(s[14:18], `.`),
+		Initial: s[18:19],
+	}
+	// The qualifier column holds the fifth page digit for pages > 9999.
+	switch q := s[13:14]; {
+	case q == `.`:
+	case q >= `0` && q <= `9`:
+		b.Page = strings.TrimLeft(s[13:18], `.`)
+	default:
+		b.Qualifier = q
+	}
+	if err := b.Validate(); err != nil {
+		return Bibcode{}, &FieldError{Field: `bibcode`, Value: s, Reason: err.(*FieldError).Reason}
+	}
+	return b, nil
+}
+
+// NewBibcode builds a bibcode from its components.
+func NewBibcode(year int, journal, volume, qualifier, page, initial string) (Bibcode, error) {
+	b := Bibcode{
+		Year:      year,
+		Journal:   strings.Trim(journal, `.`),
+		Volume:    strings.Trim(volume, `.`),
+		Qualifier: strings.Trim(qualifier, `.`),
+		Page:      strings.Trim(page, `.`),
+		Initial:   initial,
+	}
+	if b.Initial == `` {
+		b.Initial = `.`
+	}
+	if err := b.Validate(); err != nil {
+		return Bibcode{}, err
+	}
+	return b, nil
+}
+
+// Validate returns a *FieldError if a component is malformed.
+func (b Bibcode) Validate() error {
+	reason := ``
+	switch {
+	case b.Year < 1000 || b.Year > 9999:
+		reason = fmt.Sprintf(`year %d must have four digits`, b.Year)
+	case len(b.Journal) == 0 || len(b.Journal) > 5 || !bibcodeJournalPattern.MatchString(b.Journal):
+		reason = fmt.Sprintf(`journal "%s" must be 1-5 characters starting with a letter`, b.Journal)
+	case len(b.Volume) > 4:
+		reason = fmt.Sprintf(`volume "%s" must be at most 4 characters`, b.Volume)
+	case !bibcodeFieldPattern.MatchString(b.Volume):
+		reason = fmt.Sprintf(`volume "%s" may only hold letters, digits, "&" and "."`, b.Volume)
+	case len(b.Qualifier) > 1 || (b.Qualifier != `` && !bibcodeJournalPattern.MatchString(b.Qualifier)):
+		reason = fmt.Sprintf(`qualifier "%s" must be a single letter`, b.Qualifier)
+	case len(b.Page) > 5 || (len(b.Page) == 5 && b.Qualifier != ``):
+		reason = fmt.Sprintf(`page "%s" is too long`, b.Page)
+	case !bibcodeFieldPattern.MatchString(b.Page):
+		reason = fmt.Sprintf(`page "%s" may only hold letters, digits, "&" and "."`, b.Page)
+	case len(b.Initial) != 1 || !strings.ContainsAny(b.Initial, `.:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz`):
+		reason = fmt.Sprintf(`author initial "%s" must be a letter, "." or ":"`, b.Initial)
+	default:
+		return nil
+	}
+	return &FieldError{Field: `bibcode`, Value: fmt.Sprintf(`%d%s%s%s%s%s`, b.Year, b.Journal, b.Volume, b.Qualifier, b.Page, b.Initial), Reason: reason}
+}
+
+// String returns the canonical, dot-padded form.
+func (b Bibcode) String() string {
+	page := b.Page
+	qualifier := b.Qualifier
+	if len(page) == 5 {
+		qualifier, page = page[0:1], page[1:]
+	} else if qualifier == `` {
+		qualifier = `.`
+	}
+	return fmt.Sprintf(`%04d%s%s%s%s%s`, b.Year,
+		padRight(b.Journal, 5), padLeft(b.Volume, 4), qualifier, padLeft(page, 4), b.Initial)
+}
+
+func padRight(s string, n int) string {
+	return s + strings.Repeat(`.`, n-len(s))
+}
+
+func padLeft(s string, n int) string {
+	return strings.Repeat(`.`, n-len(s)) + s
+}
+
+// NormalizeBibcode returns the canonical form of s.
+func NormalizeBibcode(s string) (string, error) {
+	b, err := ParseBibcode(s)
+	if err != nil {
+		return ``, err
+	}
+	return b.String(), nil
+}
+
+func IsBibcode(s string) bool {
+	_, err := ParseBibcode(s)
+	return err == nil
+}
@@ -0,0 +1,42 @@
+package termads
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBibcode(t *testing.T) {
+	tests := []struct {
+		in, want string
+		reason   string // part of the error, if any
+	}{
+		{in: `1998ApJ...498..541K`, want: `1998ApJ...498..541K`},
+		{in: `2019ApJ 870 1S`, want: `2019ApJ...870....1S`},
+		{in: `2019ApJ.870.L1S`, want: `2019ApJ...870L...1S`},
+		{in: `2012ARA&A..50..531K`, want: `2012ARA&A..50..531K`},
+		{in: `2012ARA%26A..50..531K`, want: `2012ARA&A..50..531K`},
+		{in: `2016PhRvL.11661102A`, want: `2016PhRvL.11661102A`},
+		// legacy preprint bibcodes with dots inside the journal or volume
+		{in: `2003astro.ph..1234X`, want: `2003astro.ph..1234X`},
+		{in: `1999hep.ph....1001A`, want: `1999hep.ph....1001A`},
+		{in: `1998gr.qc.....1234X`, want: `1998gr.qc.....1234X`},
+		{in: `2001cond.mat..1234Y`, want: `2001cond.mat..1234Y`},
+		{in: `19x8ApJ...498..541K`, reason: `year "19x8" is not a number`},
+		{in: `1998ApJ...4-8..541K`, reason: `volume "4-8" may only hold letters, digits`},
+		{in: `1998ApJ...498..5-1K`, reason: `page "5-1" may only hold letters, digits`},
+		{in: `1998ApJ...498..541`, reason: `must be 19 characters`},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeBibcode(tt.in)
+		if tt.reason != `` {
+			if !errors.Is(err, ErrInvalidField) || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf(`NormalizeBibcode(%q) = %q, %v; want an error with %q`, tt.in, got, err, tt.reason)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf(`NormalizeBibcode(%q) = %q, %v; want %q`, tt.in, got, err, tt.want)
+		}
+	}
+}
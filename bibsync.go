@@ -0,0 +1,191 @@
+package termads
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*=======================================================
+/*               Sync entries into a .bib file
+/*=======================================================*/
+
+// Fields written by ADS. Other fields of an existing entry were added by
+// the user and are never touched.
+var adsBibFields = map[string]bool{
+	`author`: true, `title`: true, `journal`: true, `booktitle`: true, `year`: true, `month`: true,
+	`volume`: true, `number`: true, `pages`: true, `eid`: true, `doi`: true, `archiveprefix`: true,
+	`eprint`: true, `primaryclass`: true, `adsurl`: true, `adsnote`: true, `keywords`: true,
+	`editor`: true, `publisher`: true, `series`: true, `school`: true, `howpublished`: true,
+}
+
+type SyncResult struct {
+	Added     []string // citation keys of new entries
+	Updated   []string // preprints replaced by the refereed version
+	Unchanged []string
+}
+
+var arXivVersionPattern = regexp.MustCompile(`v\d+$`)
+
+// identifiers returns the bibcode, DOI and arXiv id of entry in a form
+// suitable for comparison.
+func identifiers(entry *BibEntry) []string {
+	ids := []string{}
+	if bibcode := entry.Bibcode(); bibcode != `` {
+		ids = append(ids, `bibcode:`+bibcode)
+	}
+	if doi := strings.ToLower(entry.DOI()); doi != `` {
+		ids = append(ids, `doi:`+doi)
+	}
+	if arxiv := entry.ArXivID(); arxiv != `` {
+		ids = append(ids, `arxiv:`+strings.ToLower(arXivVersionPattern.ReplaceAllString(arxiv, ``)))
+	}
+	return ids
+}
+
+// IsPreprint reports whether entry describes an arXiv preprint rather
+// than the published paper.
+func (entry *BibEntry) IsPreprint() bool {
+	if b, err := ParseBibcode(entry.Bibcode()); err == nil && b.Journal == `arXiv` {
+		return true
+	}
+	journal := strings.ToLower(entry.Get(`journal`))
+	return strings.Contains(journal, `arxiv`) || (entry.ArXivID() != `` && journal == `` && entry.Get(`booktitle`) == ``)
+}
+
+// Merge adds entries that are not in the file yet, matching on bibcode,
+// DOI or arXiv id. A preprint in the file is replaced by a refereed
+// entry for the same paper, keeping its citation key and user fields.
+func (file *BibFile) Merge(entries []*BibEntry) *SyncResult {
+	result := &SyncResult{Added: []string{}, Updated: []string{}, Unchanged: []string{}}
+	index := map[string]*BibEntry{}
+	keys := map[string]bool{}
+	for _, entry := range file.Entries() {
+		for _, id := range identifiers(entry) {
+			index[id] = entry
+		}
+		keys[entry.Key] = true
+	}
+	for _, entry := range entries {
+		var existing *BibEntry
+		for _, id := range identifiers(entry) {
+			if existing = index[id]; existing != nil {
+				break
+			}
+		}
+		switch {
+		case existing == nil:
+			if keys[entry.Key] {
+				base := entry.Key
+				for i := 0; keys[entry.Key]; i++ {
+					entry.SetKey(base + suffixLetters(i))
+				}
+			}
+			file.Add(entry)
+			keys[entry.Key] = true
+			result.Added = append(result.Added, entry.Key)
+		case existing.IsPreprint() && !entry.IsPreprint():
+			existing.update(entry)
+			result.Updated = append(result.Updated, existing.Key)
+		default:
+			result.Unchanged = append(result.Unchanged, existing.Key)
+			continue
+		}
+		target := existing
+		if target == nil {
+			target = entry
+		}
+		for _, id := range identifiers(target) {
+			index[id] = target
+		}
+	}
+	return result
+}
+
+// update replaces the ADS fields of entry with those of newer, keeping
+// the key and the fields added by the user.
+func (entry *BibEntry) update(newer *BibEntry) {
+	fields := []BibField{}
+	for _, field := range entry.Fields {
+		if !adsBibFields[strings.ToLower(field.Name)] {
+			fields = append(fields, field)
+		}
+	}
+	entry.Fields = append(append([]BibField{}, newer.Fields...), fields...)
+	entry.Type = newer.Type
+	entry.dirty = true
+}
+
+// ReadBibFile parses path. A missing file yields an empty BibFile.
+func ReadBibFile(path string) (*BibFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewBibFile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseBibTex(string(b))
+}
+
+// WriteBibFile replaces path atomically. The previous content, if any, is
+// kept in path+".bak".
+func WriteBibFile(path string, file *BibFile) error {
+	return replaceFile(path, func(w io.Writer) error {
+		_, err := file.WriteTo(w)
+		return err
+	})
+}
+
+// replaceFile keeps the old file as path.bak and replaces it with what
+// write produces, through a temporary file so that a crash never leaves
+// a half-written file behind.
+func replaceFile(path string, write func(io.Writer) error) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+		old, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path+`.bak`, old, mode); err != nil {
+			return err
+		}
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), `.`+filepath.Base(path)+`.`)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SyncBibFile merges entries into the .bib file at path.
+func SyncBibFile(path string, entries []*BibEntry) (*SyncResult, error) {
+	file, err := ReadBibFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := file.Merge(entries)
+	if len(result.Added) == 0 && len(result.Updated) == 0 {
+		return result, nil
+	}
+	return result, WriteBibFile(path, file)
+}
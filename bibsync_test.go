@@ -0,0 +1,224 @@
+package termads
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const syncedBib = `% my bibliography
+
+@ARTICLE{smith2019,
+       author = {{Smith}, J.},
+        title = "{A Preprint}",
+      journal = {arXiv e-prints},
+         year = 2019,
+       eprint = {1901.00001v2},
+         note = {read this first},
+         file = {smith.pdf},
+}
+
+@ARTICLE{Kennicutt1998,
+       author = {{Kennicutt}, Jr., Robert C.},
+        title = "{The Global Schmidt Law in Star-forming Galaxies}",
+      journal = {\apj},
+         year = 1998,
+          doi = {10.1086/305588},
+       adsurl = {https://ui.adsabs.harvard.edu/abs/1998ApJ...498..541K},
+}
+
+@ARTICLE{2012ARA&A..50..531K,
+       author = {{Kennicutt}, Robert C. and {Evans}, Neal J.},
+        title = "{Star Formation in the Milky Way and Nearby Galaxies}",
+      journal = {\araa},
+         year = 2012,
+       eprint = {1204.3552},
+}
+`
+
+func bibEntry(t *testing.T, text string) *BibEntry {
+	t.Helper()
+	file, err := ParseBibTex(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := file.Entries()[0]
+	entry.dirty = true
+	return entry
+}
+
+func TestMerge(t *testing.T) {
+	file, err := ParseBibTex(syncedBib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []*BibEntry{
+		// the published version of the preprint
+		bibEntry(t, `@ARTICLE{2019ApJ...870....1S,
+  author = {{Smith}, J.},
+  title = "{The Published Paper}",
+  journal = {\apj},
+  year = 2019,
+  doi = {10.3847/xyz},
+  eprint = {1901.00001},
+}`),
+		// the same DOI under another key
+		bibEntry(t, `@ARTICLE{other, doi = {10.1086/305588}, journal = {\apj}}`),
+		// the same bibcode, as the key
+		bibEntry(t, `@ARTICLE{1998ApJ...498..541K, journal = {\apj}}`),
+		// the preprint of a published paper does not replace it
+		bibEntry(t, `@ARTICLE{2012arXiv1204.3552K, journal = {arXiv e-prints}, eprint = {1204.3552v1}}`),
+		// new, with a key that is taken
+		bibEntry(t, `@ARTICLE{Kennicutt1998, doi = {10.1000/new}, journal = {\mnras}}`),
+		// twice in the same batch
+		bibEntry(t, `@ARTICLE{2020MNRAS.100..100J, journal = {\mnras}}`),
+		bibEntry(t, `@ARTICLE{2020MNRAS.100..100J, journal = {\mnras}}`),
+	}
+	result := file.Merge(entries)
+
+	want := &SyncResult{
+		Added:     []string{`Kennicutt1998a`, `2020MNRAS.100..100J`},
+		Updated:   []string{`smith2019`},
+		Unchanged: []string{`Kennicutt1998`, `Kennicutt1998`, `2012ARA&A..50..531K`, `2020MNRAS.100..100J`},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Merge = %+v\nwant %+v", result, want)
+	}
+
+	// the preprint keeps its key and the fields of the user
+	updated := file.Entry(`smith2019`)
+	fields := []struct{ name, want string }{
+		{`title`, `{The Published Paper}`},
+		{`journal`, `\apj`},
+		{`doi`, `10.3847/xyz`},
+		{`eprint`, `1901.00001`},
+		{`note`, `read this first`},
+		{`file`, `smith.pdf`},
+	}
+	for _, f := range fields {
+		if got := updated.Get(f.name); got != f.want {
+			t.Errorf(`updated %s = %q, want %q`, f.name, got, f.want)
+		}
+	}
+	if updated.IsPreprint() {
+		t.Error(`the updated entry is still a preprint`)
+	}
+
+	// the other entries are as they were
+	text := file.Text()
+	start := strings.Index(syncedBib, `@ARTICLE{Kennicutt1998,`)
+	if !strings.Contains(text, syncedBib[start:]) || !strings.HasPrefix(text, `% my bibliography`) {
+		t.Errorf("merged file:\n%s", text)
+	}
+}
+
+func TestIsPreprint(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{`@ARTICLE{2019arXiv190100001S, title = {A}}`, true},
+		{`@ARTICLE{a, journal = {ArXiv e-prints}, pages = {arXiv:1901.00001}}`, true},
+		{`@MISC{a, eprint = {1901.00001}}`, true},
+		{`@ARTICLE{a, journal = {\apj}, eprint = {1901.00001}}`, false},
+		{`@INPROCEEDINGS{a, booktitle = {Proc. SPIE}, eprint = {1901.00001}}`, false},
+	}
+	for _, tt := range tests {
+		if got := bibEntry(t, tt.text).IsPreprint(); got != tt.want {
+			t.Errorf(`IsPreprint(%s) = %v, want %v`, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSyncBibFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `refs.bib`)
+	if err := ioutil.WriteFile(path, []byte(syncedBib), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing new: the file is not written
+	result, err := SyncBibFile(path, []*BibEntry{bibEntry(t, `@ARTICLE{1998ApJ...498..541K, journal = {\apj}}`)})
+	if err != nil || len(result.Unchanged) != 1 {
+		t.Fatalf(`SyncBibFile = %+v, %v`, result, err)
+	}
+	if _, err := os.Stat(path + `.bak`); !os.IsNotExist(err) {
+		t.Errorf(`a backup was made without changes: %v`, err)
+	}
+
+	added := bibEntry(t, `@ARTICLE{2020MNRAS.100..100J, journal = {\mnras}}`)
+	if _, err := SyncBibFile(path, []*BibEntry{added}); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadFile(path + `.bak`)
+	if err != nil || string(backup) != syncedBib {
+		t.Errorf(`backup = %q, %v; want the previous file`, backup, err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := syncedBib + "\n" + added.String() + "\n"; string(data) != want {
+		t.Errorf("synced file:\n%s", diffLines(want, string(data)))
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf(`mode = %v, %v; want the mode of the file replaced`, info.Mode(), err)
+	}
+	assertFiles(t, dir, `refs.bib`, `refs.bib.bak`)
+
+	// a new file has no backup
+	path = filepath.Join(dir, `new.bib`)
+	if _, err := SyncBibFile(path, []*BibEntry{added}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != added.String()+"\n" {
+		t.Errorf(`new file = %q, %v`, data, err)
+	}
+	assertFiles(t, dir, `new.bib`, `refs.bib`, `refs.bib.bak`)
+}
+
+// TestReplaceFileFailure checks that a failed write leaves the file and
+// no temporary file behind.
+func TestReplaceFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, `refs.bib`)
+	if err := ioutil.WriteFile(path, []byte(syncedBib), 0644); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New(`disk full`)
+	err := replaceFile(path, func(w io.Writer) error {
+		io.WriteString(w, `half`)
+		return failed
+	})
+	if err != failed {
+		t.Errorf(`err = %v, want %v`, err, failed)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != syncedBib {
+		t.Errorf(`the file became %q`, data)
+	}
+	assertFiles(t, dir, `refs.bib`, `refs.bib.bak`)
+}
+
+// assertFiles checks that dir holds exactly names.
+func assertFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+	want := append([]string{}, names...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf(`files %q, want %q`, got, want)
+	}
+}
@@ -0,0 +1,731 @@
+package termads
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*=======================================================
+/*                 BibTeX parser/writer
+/*=======================================================*/
+
+// BibField is one "name = value" pair. Value is kept as written, e.g.
+// `{\apj}`, `"{Title}"`, `2019` or `jan`.
+type BibField struct {
+	Name  string
+	Value string
+}
+
+type BibEntry struct {
+	Type   string
+	Key    string
+	Fields []BibField
+	raw    string
+	dirty  bool
+}
+
+// BibFile keeps everything between entries (comments, @string,
+// @preamble, @comment) verbatim so that unchanged files round-trip.
+type BibFile struct {
+	items   []interface{} // string or *BibEntry
+	strings map[string]string
+}
+
+type bibParser struct {
+	text string
+	pos  int
+}
+
+// ParseBibTex parses BibTeX text.
+func ParseBibTex(text string) (*BibFile, error) {
+	file := &BibFile{strings: map[string]string{}}
+	p := &bibParser{text: text}
+	last := 0
+	for {
+		at := strings.IndexByte(p.text[p.pos:], '@')
+		if at < 0 {
+			break
+		}
+		start := p.pos + at
+		p.pos = start + 1
+		p.skipSpace()
+		typ := p.readWhile(isBibIdentChar)
+		p.skipSpace()
+		if typ == `` || p.pos >= len(p.text) || (p.text[p.pos] != '{' && p.text[p.pos] != '(') {
+			// a stray "@" in free text
+			continue
+		}
+		end, err := p.matching(p.pos)
+		if err != nil {
+			return nil, err
+		}
+		if start > last {
+			file.items = append(file.items, p.text[last:start])
+		}
+		raw := p.text[start : end+1]
+		switch strings.ToLower(typ) {
+		case `comment`, `preamble`:
+			file.items = append(file.items, raw)
+		case `string`:
+			file.items = append(file.items, raw)
+			q := &bibParser{text: p.text[:end], pos: p.pos + 1}
+			fields, err := q.fields()
+			if err != nil {
+				return nil, err
+			}
+			for _, field := range fields {
+				file.strings[strings.ToLower(field.Name)] = unwrapBibValue(field.Value)
+			}
+		default:
+			q := &bibParser{text: p.text[:end], pos: p.pos + 1}
+			q.skipSpace()
+			key := strings.TrimSpace(q.readWhile(func(c byte) bool { return c != ',' }))
+			fields, err := q.fields()
+			if err != nil {
+				return nil, err
+			}
+			file.items = append(file.items, &BibEntry{Type: typ, Key: key, Fields: fields, raw: raw})
+		}
+		p.pos = end + 1
+		last = p.pos
+	}
+	if last < len(p.text) {
+		file.items = append(file.items, p.text[last:])
+	}
+	return file, nil
+}
+
+func isBibIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *bibParser) line(pos int) int {
+	return strings.Count(p.text[:pos], "\n") + 1
+}
+
+func (p *bibParser) errorf(pos int, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(`line %d: `, p.line(pos)) + fmt.Sprintf(format, args...)
+	return &ParseError{What: `BibTeX`, Msg: msg, Snippet: snippet(p.text, pos)}
+}
+
+func (p *bibParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *bibParser) readWhile(f func(byte) bool) string {
+	start := p.pos
+	for p.pos < len(p.text) && f(p.text[p.pos]) {
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// matching returns the position of the delimiter closing the one at pos.
+func (p *bibParser) matching(pos int) (int, error) {
+	open := p.text[pos]
+	close := byte('}')
+	if open == '(' {
+		close = ')'
+	}
+	depth := 0
+	for i := pos; i < len(p.text); i++ {
+		switch c := p.text[i]; {
+		case c == '\\' && i+1 < len(p.text):
+			i++
+		case c == '{' && open != '{':
+			depth++
+		case c == '}' && open != '{':
+			depth--
+		case c == open:
+			depth++
+		case c == close:
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, p.errorf(pos, `unbalanced "%c"`, open)
+}
+
+// fields parses "name = value, ..." up to the end of p.text.
+func (p *bibParser) fields() ([]BibField, error) {
+	fields := []BibField{}
+	for {
+		p.skipSpace()
+		for p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.pos++
+			p.skipSpace()
+		}
+		if p.pos >= len(p.text) {
+			return fields, nil
+		}
+		name := p.readWhile(func(c byte) bool { return strings.IndexByte(" \t\r\n=,{}\"#", c) < 0 })
+		p.skipSpace()
+		if name == `` || p.pos >= len(p.text) || p.text[p.pos] != '=' {
+			return nil, p.errorf(p.pos, `expected "name = value"`)
+		}
+		p.pos++
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, BibField{Name: name, Value: value})
+	}
+}
+
+// value reads a (possibly "#"-concatenated) field value.
+func (p *bibParser) value() (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.text) {
+			return ``, p.errorf(start, `missing value`)
+		}
+		switch p.text[p.pos] {
+		case '{':
+			end, err := p.matching(p.pos)
+			if err != nil {
+				return ``, err
+			}
+			p.pos = end + 1
+		case '"':
+			end := closingQuote(p.text[p.pos:])
+			if end < 0 {
+				return ``, p.errorf(p.pos, `unterminated string`)
+			}
+			p.pos += end + 1
+		default:
+			if p.readWhile(func(c byte) bool { return strings.IndexByte(" \t\r\n,#{}\"", c) < 0 }) == `` {
+				return ``, p.errorf(p.pos, `missing value`)
+			}
+		}
+		end := p.pos
+		p.skipSpace()
+		if p.pos < len(p.text) && p.text[p.pos] == '#' {
+			p.pos++
+			continue
+		}
+		return strings.TrimSpace(p.text[start:end]), nil
+	}
+}
+
+// unwrapBibValue strips one level of {} or "" around a value. Values
+// concatenated with # are returned as they are.
+func unwrapBibValue(value string) string {
+	if len(value) >= 2 {
+		if value[0] == '"' && closingQuote(value) == len(value)-1 {
+			return value[1 : len(value)-1]
+		}
+		if value[0] == '{' {
+			p := &bibParser{text: value}
+			if end, err := p.matching(0); err == nil && end == len(value)-1 {
+				return value[1 : len(value)-1]
+			}
+		}
+	}
+	return value
+}
+
+// closingQuote returns the position of the quote closing the one that
+// starts value, or -1.
+func closingQuote(value string) int {
+	depth := 0
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\':
+			i++
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '"' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+/*=======================================================
+/*                    BibFile
+/*=======================================================*/
+
+func NewBibFile() *BibFile {
+	return &BibFile{strings: map[string]string{}}
+}
+
+func (file *BibFile) Entries() []*BibEntry {
+	entries := []*BibEntry{}
+	for _, item := range file.items {
+		if entry, ok := item.(*BibEntry); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Entry returns the entry with the given citation key.
+func (file *BibFile) Entry(key string) *BibEntry {
+	for _, entry := range file.Entries() {
+		if entry.Key == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (file *BibFile) Add(entry *BibEntry) {
+	if n := len(file.items); n > 0 {
+		switch s, ok := file.items[n-1].(string); {
+		case !ok || !strings.HasSuffix(s, "\n"):
+			file.items = append(file.items, "\n\n")
+		case !strings.HasSuffix(s, "\n\n"):
+			file.items = append(file.items, "\n")
+		}
+	}
+	file.items = append(file.items, entry)
+}
+
+func (file *BibFile) Remove(entry *BibEntry) {
+	for i, item := range file.items {
+		if item == entry {
+			file.items = append(file.items[:i], file.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// Macro returns the value of an @string macro.
+func (file *BibFile) Macro(name string) (string, bool) {
+	value, ok := file.strings[strings.ToLower(name)]
+	return value, ok
+}
+
+func (file *BibFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, file.Text())
+	return int64(n), err
+}
+
+// Text renders the file. Entries that were not modified are written
+// exactly as they were read.
+func (file *BibFile) Text() string {
+	var b strings.Builder
+	for _, item := range file.items {
+		switch item := item.(type) {
+		case string:
+			b.WriteString(item)
+		case *BibEntry:
+			b.WriteString(item.String())
+		}
+	}
+	text := b.String()
+	if text != `` && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// ExpandJournalMacros replaces ADS journal macros such as \apj with the
+// journal name, for documents that do not load the AASTeX macros.
+func (file *BibFile) ExpandJournalMacros() {
+	for _, entry := range file.Entries() {
+		journal := entry.Get(`journal`)
+		if name, ok := JournalName(journal); ok {
+			entry.Set(`journal`, name)
+		}
+	}
+}
+
+const (
+	KEY_BIBCODE     = `%b`
+	KEY_AUTHOR_YEAR = `%a%y`
+)
+
+// Rekey sets citation keys built from pattern (see BibEntry.CitationKey).
+// Entries sharing a key get suffixes a, b, c... in file order. It
+// returns the map from old to new keys.
+func (file *BibFile) Rekey(pattern string) map[string]string {
+	entries := file.Entries()
+	groups := map[string][]*BibEntry{}
+	bases := []string{}
+	for _, entry := range entries {
+		base := entry.CitationKey(pattern)
+		if _, ok := groups[base]; !ok {
+			bases = append(bases, base)
+		}
+		groups[base] = append(groups[base], entry)
+	}
+	sort.Strings(bases)
+	renamed := map[string]string{}
+	for _, base := range bases {
+		group := groups[base]
+		for i, entry := range group {
+			key := base
+			if len(group) > 1 {
+				key += suffixLetters(i)
+			}
+			if key != entry.Key {
+				renamed[entry.Key] = key
+				entry.SetKey(key)
+			}
+		}
+	}
+	return renamed
+}
+
+// suffixLetters returns a, b, ..., z, aa, ab, ...
+func suffixLetters(i int) string {
+	s := ``
+	for {
+		s = string(rune('a'+i%26)) + s
+		i = i/26 - 1
+		if i < 0 {
+			return s
+		}
+	}
+}
+
+/*=======================================================
+/*                    BibEntry
+/*=======================================================*/
+
+func NewBibEntry(typ, key string) *BibEntry {
+	return &BibEntry{Type: typ, Key: key, dirty: true}
+}
+
+func (entry *BibEntry) field(name string) *BibField {
+	for i := range entry.Fields {
+		if strings.EqualFold(entry.Fields[i].Name, name) {
+			return &entry.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Get returns the value of a field without its outer braces or quotes.
+func (entry *BibEntry) Get(name string) string {
+	if field := entry.field(name); field != nil {
+		return unwrapBibValue(field.Value)
+	}
+	return ``
+}
+
+func (entry *BibEntry) Has(name string) bool {
+	return entry.field(name) != nil
+}
+
+// Set sets a field to {value}.
+func (entry *BibEntry) Set(name, value string) {
+	entry.SetRaw(name, `{`+value+`}`)
+}
+
+// SetRaw sets a field to value as written, e.g. a macro name.
+func (entry *BibEntry) SetRaw(name, value string) {
+	entry.dirty = true
+	if field := entry.field(name); field != nil {
+		field.Value = value
+		return
+	}
+	entry.Fields = append(entry.Fields, BibField{Name: name, Value: value})
+}
+
+func (entry *BibEntry) Delete(name string) {
+	for i := range entry.Fields {
+		if strings.EqualFold(entry.Fields[i].Name, name) {
+			entry.Fields = append(entry.Fields[:i], entry.Fields[i+1:]...)
+			entry.dirty = true
+			return
+		}
+	}
+}
+
+func (entry *BibEntry) SetKey(key string) {
+	entry.Key = key
+	entry.dirty = true
+}
+
+// String returns the entry in the layout used by ADS.
+func (entry *BibEntry) String() string {
+	if !entry.dirty && entry.raw != `` {
+		return entry.raw
+	}
+	lines := make([]string, len(entry.Fields))
+	for i, field := range entry.Fields {
+		lines[i] = fmt.Sprintf(`%13s = %s`, field.Name, field.Value)
+	}
+	s := `@` + entry.Type + `{` + entry.Key + `,` + "\n"
+	if len(lines) > 0 {
+		s += strings.Join(lines, ",\n") + "\n"
+	}
+	return s + `}`
+}
+
+var adsURLPattern = regexp.MustCompile(`/abs/([^/\s}]+)`)
+
+// Bibcode returns the bibcode from the adsurl field or the key.
+func (entry *BibEntry) Bibcode() string {
+	if m := adsURLPattern.FindStringSubmatch(entry.Get(`adsurl`)); m != nil {
+		if bibcode, err := NormalizeBibcode(strings.Replace(m[1], `%26`, `&`, -1)); err == nil {
+			return bibcode
+		}
+	}
+	if bibcode, err := NormalizeBibcode(strings.Replace(entry.Key, `\&`, `&`, -1)); err == nil {
+		return bibcode
+	}
+	return ``
+}
+
+func (entry *BibEntry) DOI() string {
+	return strings.TrimSpace(entry.Get(`doi`))
+}
+
+// ArXivID returns the eprint of arXiv preprints.
+func (entry *BibEntry) ArXivID() string {
+	eprint := strings.TrimSpace(entry.Get(`eprint`))
+	eprint = strings.TrimPrefix(strings.TrimPrefix(eprint, `arXiv:`), `arxiv:`)
+	if eprint != `` {
+		return eprint
+	}
+	if strings.EqualFold(entry.Get(`journal`), `arXiv e-prints`) || strings.EqualFold(entry.Get(`journal`), `ArXiv e-prints`) {
+		return strings.TrimPrefix(entry.Get(`pages`), `arXiv:`)
+	}
+	return ``
+}
+
+// Authors splits the author field on " and " outside braces.
+func (entry *BibEntry) Authors() []string {
+	authors := []string{}
+	value := entry.Get(`author`)
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ' ', '\n', '\t':
+			if depth == 0 && i+5 <= len(value) && strings.EqualFold(value[i:i+5], ` and `) {
+				authors = append(authors, strings.TrimSpace(value[start:i]))
+				start = i + 5
+				i += 4
+			}
+		}
+	}
+	if last := strings.TrimSpace(value[start:]); last != `` {
+		authors = append(authors, last)
+	}
+	return authors
+}
+
+// CitationKey builds a key from pattern where
+//
+//	%a  last name of the first author
+//	%y  four-digit year, %Y two-digit year
+//	%j  journal (bibstem)
+//	%t  first significant word of the title
+//	%b  bibcode
+func (entry *BibEntry) CitationKey(pattern string) string {
+	bibcode := entry.Bibcode()
+	year := entry.Get(`year`)
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'a':
+			if authors := entry.Authors(); len(authors) > 0 {
+				last := authors[0]
+				if k := strings.Index(last, `,`); k >= 0 {
+					last = last[:k]
+				} else if words := strings.Fields(last); len(words) > 0 {
+					last = words[len(words)-1]
+				}
+				b.WriteString(asciiLetters(last))
+			}
+		case 'y':
+			b.WriteString(year)
+		case 'Y':
+			if len(year) == 4 {
+				b.WriteString(year[2:])
+			}
+		case 'j':
+			journal := entry.Get(`journal`)
+			if bibstem, ok := JournalFromMacro(journal); ok {
+				journal = bibstem
+			} else if parsed, err := ParseBibcode(bibcode); err == nil {
+				journal = parsed.Journal
+			}
+			b.WriteString(asciiLetters(journal))
+		case 't':
+			for _, word := range strings.Fields(entry.Get(`title`)) {
+				word = asciiLetters(word)
+				if len(word) > 3 && !titleStopWords[strings.ToLower(word)] {
+					b.WriteString(strings.Title(strings.ToLower(word)))
+					break
+				}
+			}
+		case 'b':
+			b.WriteString(bibcode)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	if b.Len() == 0 {
+		return entry.Key
+	}
+	return b.String()
+}
+
+var titleStopWords = map[string]bool{`the`: true, `from`: true, `with`: true, `into`: true, `onto`: true, `over`: true, `under`: true}
+
+// asciiLetters strips braces, TeX accent commands and non-letters,
+// folding common accented letters to ASCII.
+func asciiLetters(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if folded, ok := accentFolding[r]; ok {
+			return folded
+		}
+		return r
+	}, s)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' {
+			// drop single-symbol commands such as \' and \"
+			if i+1 < len(s) && !isBibIdentChar(s[i+1]) {
+				i++
+			}
+			continue
+		}
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+var accentFolding = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ä': 'a', 'ã': 'a', 'å': 'a', 'Á': 'A', 'À': 'A', 'Â': 'A', 'Ä': 'A', 'Å': 'A',
+	'é': 'e', 'è': 'e', 'ê': 'e', 'ë': 'e', 'É': 'E', 'È': 'E',
+	'í': 'i', 'ì': 'i', 'î': 'i', 'ï': 'i', 'Í': 'I',
+	'ó': 'o', 'ò': 'o', 'ô': 'o', 'ö': 'o', 'õ': 'o', 'ø': 'o', 'Ó': 'O', 'Ö': 'O', 'Ø': 'O',
+	'ú': 'u', 'ù': 'u', 'û': 'u', 'ü': 'u', 'Ú': 'U', 'Ü': 'U',
+	'ç': 'c', 'Ç': 'C', 'ñ': 'n', 'Ñ': 'N', 'ý': 'y', 'ÿ': 'y', 'š': 's', 'Š': 'S', 'ž': 'z', 'Ž': 'Z', 'č': 'c', 'Č': 'C', 'ł': 'l', 'Ł': 'L',
+}
+
+/*=======================================================
+/*                  LaTeX escaping
+/*=======================================================*/
+
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+	`á`, `{\'a}`, `à`, "{\\`a}", `â`, `{\^a}`, `ä`, `{\"a}`, `å`, `{\aa}`,
+	`é`, `{\'e}`, `è`, "{\\`e}", `ê`, `{\^e}`, `ë`, `{\"e}`,
+	`í`, `{\'i}`, `ï`, `{\"i}`,
+	`ó`, `{\'o}`, `ò`, "{\\`o}", `ô`, `{\^o}`, `ö`, `{\"o}`, `ø`, `{\o}`,
+	`ú`, `{\'u}`, `ù`, "{\\`u}", `û`, `{\^u}`, `ü`, `{\"u}`,
+	`ç`, `{\c{c}}`, `ñ`, `{\~n}`, `ß`, `{\ss}`,
+	`Á`, `{\'A}`, `Ä`, `{\"A}`, `Å`, `{\AA}`, `É`, `{\'E}`, `Ö`, `{\"O}`, `Ø`, `{\O}`, `Ü`, `{\"U}`,
+)
+
+// EscapeLaTeX escapes the LaTeX special characters of plain text and
+// writes accented letters as TeX accents.
+func EscapeLaTeX(s string) string {
+	return latexEscaper.Replace(s)
+}
+
+var unescapedSpecials = regexp.MustCompile(`(^|[^\\])([&%#])`)
+
+// escapeBibText escapes text for a field. Text which already contains TeX
+// markup (math or commands), as ADS titles often do, only gets its bare
+// &, % and # escaped.
+func escapeBibText(s string) string {
+	if strings.ContainsAny(s, `$\`) {
+		return unescapedSpecials.ReplaceAllString(s, `$1\$2`)
+	}
+	return EscapeLaTeX(s)
+}
+
+/*=======================================================
+/*                Paper -> BibTeX entry
+/*=======================================================*/
+
+var bibMonths = []string{`jan`, `feb`, `mar`, `apr`, `may`, `jun`, `jul`, `aug`, `sep`, `oct`, `nov`, `dec`}
+
+// NewBibEntryFromPaper generates an entry from the paper metadata in the
+// layout ADS uses, keyed by the bibcode.
+func NewBibEntryFromPaper(p Paper) *BibEntry {
+	meta := p.Metadata()
+	bibcode, _ := ParseBibcode(p.GetBibcode())
+	entry := NewBibEntry(`ARTICLE`, p.GetBibcode())
+	authors := []string{}
+	for _, author := range meta.Authors {
+		name := `{` + escapeBibText(author.Last) + `}`
+		if author.Suffix != `` {
+			name += `, ` + escapeBibText(author.Suffix)
+		}
+		if author.First != `` {
+			name += `, ` + strings.Replace(escapeBibText(author.Initials()), ` `, `~`, -1)
+		}
+		authors = append(authors, name)
+	}
+	if len(authors) > 0 {
+		entry.Set(`author`, strings.Join(authors, ` and `))
+	}
+	if title := p.GetTitle(); title != `` {
+		entry.SetRaw(`title`, `"{`+escapeBibText(title)+`}"`)
+	}
+	if len(meta.Keywords) > 0 {
+		entry.Set(`keywords`, escapeBibText(strings.Join(meta.Keywords, `, `)))
+	}
+	if meta.Bibstem == `arXiv` {
+		entry.Set(`journal`, `arXiv e-prints`)
+	} else if meta.Bibstem != `` {
+		entry.Set(`journal`, JournalMacro(meta.Bibstem, bibcode.Qualifier))
+	}
+	if meta.Year > 0 {
+		entry.SetRaw(`year`, fmt.Sprint(meta.Year))
+	}
+	if meta.Month > 0 {
+		entry.SetRaw(`month`, bibMonths[meta.Month-1])
+	}
+	if meta.Volume != `` && meta.Bibstem != `arXiv` {
+		entry.Set(`volume`, meta.Volume)
+	}
+	if meta.Page != `` {
+		entry.Set(`pages`, meta.Page)
+	}
+	if meta.DOI != `` {
+		entry.Set(`doi`, meta.DOI)
+	}
+	if meta.ArXivID != `` {
+		entry.Set(`archivePrefix`, `arXiv`)
+		entry.Set(`eprint`, meta.ArXivID)
+	}
+	entry.Set(`adsurl`, ADS_UI_URL+`/abs/`+p.GetBibcode())
+	entry.Set(`adsnote`, `Provided by the SAO/NASA Astrophysics Data System`)
+	return entry
+}
+
+func bibtexEntry(p Paper) string {
+	return NewBibEntryFromPaper(p).String()
+}
@@ -0,0 +1,242 @@
+package termads
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readRoundTrip(t *testing.T) (string, *BibFile) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(`testdata`, `roundtrip.bib`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ParseBibTex(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), file
+}
+
+func TestBibTexRoundTrip(t *testing.T) {
+	text, file := readRoundTrip(t)
+	if got := file.Text(); got != text {
+		t.Errorf("the file changed:\n%s", diffLines(text, got))
+	}
+
+	keys := []string{}
+	for _, entry := range file.Entries() {
+		keys = append(keys, entry.Key)
+	}
+	if want := []string{`1998ApJ...498..541K`, `smith2019`, `jones2020`}; !reflect.DeepEqual(keys, want) {
+		t.Errorf(`keys = %q, want %q`, keys, want)
+	}
+	macros := []struct{ name, want string }{
+		{`apj`, `Astrophysical Journal`},
+		{`MNRAS`, `Monthly Notices of the RAS`},
+	}
+	for _, m := range macros {
+		if got, ok := file.Macro(m.name); !ok || got != m.want {
+			t.Errorf(`Macro(%s) = %q, %v; want %q`, m.name, got, ok, m.want)
+		}
+	}
+
+	values := []struct{ key, field, want string }{
+		{`1998ApJ...498..541K`, `title`, `{The Global Schmidt Law in Star-forming Galaxies}`},
+		{`1998ApJ...498..541K`, `YEAR`, `1998`},
+		{`1998ApJ...498..541K`, `month`, `may`},
+		{`smith2019`, `title`, `On {{Nested}} {B}races and {\"O}pik's \{law\}`},
+		{`smith2019`, `journal`, `apj # " Letters"`},
+		{`smith2019`, `note`, `"Quoted " # {and braced} # " parts, with a \"quote\""`},
+		{`smith2019`, `year`, `2019`},
+		{`jones2020`, `title`, `Parenthesised entries (and parentheses inside)`},
+		{`jones2020`, `booktitle`, `mnras`},
+	}
+	for _, v := range values {
+		if got := file.Entry(v.key).Get(v.field); got != v.want {
+			t.Errorf(`%s %s = %q, want %q`, v.key, v.field, got, v.want)
+		}
+	}
+	authors := file.Entry(`smith2019`).Authors()
+	if want := []string{`Smith, J.`, `{de la Cruz}, M.`, `{The {LIGO} Collaboration}`}; !reflect.DeepEqual(authors, want) {
+		t.Errorf(`authors = %q, want %q`, authors, want)
+	}
+}
+
+// TestBibTexEdit checks that only the entries changed are rewritten.
+func TestBibTexEdit(t *testing.T) {
+	text, file := readRoundTrip(t)
+	entry := file.Entry(`jones2020`)
+	entry.Set(`doi`, `10.1000/xyz`)
+	entry.Delete(`booktitle`)
+	got := file.Text()
+
+	rewritten := "@inproceedings{jones2020,\n" +
+		"       author = \"Jones, A.\",\n" +
+		"        title = {Parenthesised entries (and parentheses inside)},\n" +
+		"         year = 2020,\n" +
+		"          doi = {10.1000/xyz}\n" +
+		"}\n"
+	start := strings.Index(text, `@inproceedings(`)
+	if want := text[:start] + rewritten; got != want {
+		t.Errorf("edit:\n%s", diffLines(want, got))
+	}
+
+	file.Add(NewBibEntry(`misc`, `new`))
+	if !strings.HasSuffix(file.Text(), rewritten+"\n@misc{new,\n}\n") {
+		t.Errorf("added entry:\n%s", file.Text()[start:])
+	}
+	file.Remove(file.Entry(`new`))
+	file.Remove(entry)
+	if file.Entry(`jones2020`) != nil || !strings.HasPrefix(file.Text(), text[:start]) {
+		t.Errorf("after removing:\n%s", file.Text())
+	}
+}
+
+func TestParseBibTexErrors(t *testing.T) {
+	tests := []struct {
+		name, text, msg string
+	}{
+		{`unbalanced entry`, "@article{key,\n  title = {A}\n", `line 1: unbalanced "{"`},
+		{`unbalanced value`, "@article{key,\n  title = {A {B}\n}\n", `line 1: unbalanced "{"`},
+		{`no equals sign`, "@article{key,\n  title {A}\n}\n", `line 2: expected "name = value"`},
+		{`missing value`, "@article{key,\n  title = ,\n}\n", `line 2: missing value`},
+		{`missing value at the end`, "@article{key,\n  title =\n}", `line 3: missing value`},
+		{`unterminated string`, "@article{key,\n\n  title = \"A}", `line 3: unterminated string`},
+		{`bad @string`, "@string{apj}\n", `line 1: expected "name = value"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseBibTex(tt.text)
+		var perr *ParseError
+		if !errors.As(err, &perr) || !errors.Is(err, ErrParse) || !strings.Contains(perr.Msg, tt.msg) {
+			t.Errorf(`%s: err = %v, want a ParseError with %q`, tt.name, err, tt.msg)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	file, err := ParseBibTex(`
+@article{a, author = {{Smith}, J.}, year = 2019, title = {First}}
+@article{b, author = {Jones, A. and Smith, J.}, year = 2019}
+@article{c, author = {J. Smith}, year = 2019, title = {Third}}
+@article{d, author = {Smith, J.}, year = 2020}
+@article{Smith2019b, author = {Sm{\"i}th, J.}, year = 2019}
+@article{e, year = 2021, adsurl = {https://ui.adsabs.harvard.edu/abs/2012ARA%26A..50..531K}}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := file.Rekey(KEY_AUTHOR_YEAR)
+	// entries sharing a key get suffixes in file order, whatever their
+	// key was; Sm{\"i}th is Smith
+	want := map[string]string{
+		`a`:          `Smith2019a`,
+		`b`:          `Jones2019`,
+		`c`:          `Smith2019b`,
+		`d`:          `Smith2020`,
+		`Smith2019b`: `Smith2019c`,
+		`e`:          `2021`,
+	}
+	if !reflect.DeepEqual(renamed, want) {
+		t.Errorf(`Rekey(%s) = %v, want %v`, KEY_AUTHOR_YEAR, renamed, want)
+	}
+	keys := []string{}
+	for _, entry := range file.Entries() {
+		keys = append(keys, entry.Key)
+	}
+	if want := []string{`Smith2019a`, `Jones2019`, `Smith2019b`, `Smith2020`, `Smith2019c`, `2021`}; !reflect.DeepEqual(keys, want) {
+		t.Errorf(`keys = %q, want %q`, keys, want)
+	}
+	if !strings.Contains(file.Text(), "@article{Smith2019a,\n       author = {{Smith}, J.},\n") {
+		t.Errorf("rekeyed file:\n%s", file.Text())
+	}
+	if renamed := file.Rekey(KEY_AUTHOR_YEAR); len(renamed) != 0 {
+		t.Errorf(`Rekey(%s) again renamed %v`, KEY_AUTHOR_YEAR, renamed)
+	}
+
+	renamed = file.Rekey(KEY_BIBCODE)
+	if got := renamed[`2021`]; got != `2012ARA&A..50..531K` {
+		t.Errorf(`Rekey(%s) renamed 2021 to %q`, KEY_BIBCODE, got)
+	}
+	// without a bibcode the key is kept
+	if _, ok := renamed[`Jones2019`]; ok {
+		t.Errorf(`Rekey(%s) renamed Jones2019 to %q`, KEY_BIBCODE, renamed[`Jones2019`])
+	}
+}
+
+func TestCitationKey(t *testing.T) {
+	file, err := ParseBibTex(`@ARTICLE{2012ARA&A..50..531K,
+  author = {{Kennicutt}, Robert C. and {Evans}, Neal J.},
+  title = "{The Star Formation in the Milky Way and Nearby Galaxies}",
+  journal = {\araa},
+  year = 2012,
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := file.Entries()[0]
+	tests := []struct{ pattern, want string }{
+		{`%a%y`, `Kennicutt2012`},
+		{`%a:%Y%j`, `Kennicutt:12ARAA`},
+		{`%a%t`, `KennicuttStar`},
+		{`%b`, `2012ARA&A..50..531K`},
+		{`%q`, `%q`},
+	}
+	for _, tt := range tests {
+		if got := entry.CitationKey(tt.pattern); got != tt.want {
+			t.Errorf(`CitationKey(%s) = %q, want %q`, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeLaTeX(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`A & B`, `A \& B`},
+		{`50% of $5 #1 a_b`, `50\% of \$5 \#1 a\_b`},
+		{`{x} ~ ^ \`, `\{x\} \textasciitilde{} \textasciicircum{} \textbackslash{}`},
+		{`Öpik, Gómez & Müller`, `{\"O}pik, G{\'o}mez \& M{\"u}ller`},
+		{`Ångström, Søren`, `{\AA}ngstr{\"o}m, S{\o}ren`},
+	}
+	for _, tt := range tests {
+		if got := EscapeLaTeX(tt.in); got != tt.want {
+			t.Errorf(`EscapeLaTeX(%q) = %q, want %q`, tt.in, got, tt.want)
+		}
+	}
+
+	// TeX in ADS titles is kept; only bare specials are escaped
+	bib := []struct{ in, want string }{
+		{`Dust & Gas`, `Dust \& Gas`},
+		{`H$_2$ & CO at z$\sim$2`, `H$_2$ \& CO at z$\sim$2`},
+		{`already \& escaped, 5%`, `already \& escaped, 5\%`},
+	}
+	for _, tt := range bib {
+		if got := escapeBibText(tt.in); got != tt.want {
+			t.Errorf(`escapeBibText(%q) = %q, want %q`, tt.in, got, tt.want)
+		}
+	}
+}
+
+// diffLines shows the first line where want and got differ.
+func diffLines(want, got string) string {
+	w := strings.Split(want, "\n")
+	g := strings.Split(got, "\n")
+	for i := 0; i < len(w) || i < len(g); i++ {
+		if i < len(w) && i < len(g) && w[i] == g[i] {
+			continue
+		}
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, wl, gl)
+	}
+	return ``
+}
@@ -0,0 +1,278 @@
+package termads
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*=======================================================
+/*                  On-disk cache
+/*=======================================================*/
+
+// Kinds of cached data. Each kind lives in its own subdirectory and has
+// its own TTL.
+const (
+	CACHE_SEARCH   = `search`
+	CACHE_ABSTRACT = `abstract`
+	CACHE_EXPORT   = `export`
+)
+
+const DEFAULT_CACHE_SIZE int64 = 64 << 20
+
+var DEFAULT_CACHE_TTL = map[string]time.Duration{
+	CACHE_SEARCH:   24 * time.Hour,
+	CACHE_ABSTRACT: 90 * 24 * time.Hour,
+	CACHE_EXPORT:   30 * 24 * time.Hour,
+}
+
+// Cache stores response bodies under Dir, one file per key. A nil *Cache
+// is valid and caches nothing.
+type Cache struct {
+	Dir     string
+	MaxSize int64 // bytes; the oldest files are removed beyond this
+	TTL     map[string]time.Duration
+	Refresh bool // ignore cached data, but store fresh responses
+	Offline bool // never go to the network; a miss is an error
+
+	mu    sync.Mutex
+	size  int64 // -1 until the directory has been measured
+	stats CacheStats
+	now   func() time.Time // nil means time.Now
+}
+
+type CacheStats struct {
+	Hits      int
+	Misses    int
+	Expired   int // misses because the entry was older than its TTL
+	Writes    int
+	Evictions int
+	Entries   int   // files on disk
+	Size      int64 // bytes on disk
+}
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/termads, falling back to the
+// user cache directory of the platform (~/.cache/termads on Linux).
+func DefaultCacheDir() string {
+	dir := os.Getenv(`XDG_CACHE_HOME`)
+	if dir == `` {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			dir = os.TempDir()
+		}
+	}
+	return filepath.Join(dir, `termads`)
+}
+
+func NewCache(dir string) *Cache {
+	ttl := map[string]time.Duration{}
+	for kind, d := range DEFAULT_CACHE_TTL {
+		ttl[kind] = d
+	}
+	return &Cache{Dir: dir, MaxSize: DEFAULT_CACHE_SIZE, TTL: ttl, size: -1}
+}
+
+func (cache *Cache) clock() time.Time {
+	if cache.now != nil {
+		return cache.now()
+	}
+	return time.Now()
+}
+
+func (cache *Cache) path(kind, key string) string {
+	sum := sha1.Sum([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(cache.Dir, kind, name[:2], name)
+}
+
+// Get returns the data stored for key unless it is older than the TTL of
+// kind. In refresh mode it always misses.
+func (cache *Cache) Get(kind, key string) ([]byte, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.Refresh {
+		cache.stats.Misses++
+		return nil, false
+	}
+	path := cache.path(kind, key)
+	info, err := os.Stat(path)
+	if err != nil {
+		cache.stats.Misses++
+		return nil, false
+	}
+	// Offline, stale data is better than none.
+	if ttl, ok := cache.TTL[kind]; ok && ttl > 0 && cache.clock().Sub(info.ModTime()) > ttl && !cache.Offline {
+		cache.stats.Misses++
+		cache.stats.Expired++
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		cache.stats.Misses++
+		return nil, false
+	}
+	cache.stats.Hits++
+	return data, true
+}
+
+// Put stores data for key and evicts old entries if the cache grows
+// beyond MaxSize.
+func (cache *Cache) Put(kind, key string, data []byte) error {
+	if cache == nil {
+		return nil
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	path := cache.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if cache.size < 0 {
+		cache.measure()
+	}
+	if info, err := os.Stat(path); err == nil {
+		cache.size -= info.Size()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), `.tmp`)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	now := cache.clock()
+	if err := os.Chtimes(tmp.Name(), now, now); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	cache.size += int64(len(data))
+	cache.stats.Writes++
+	if cache.MaxSize > 0 && cache.size > cache.MaxSize {
+		return cache.evict(cache.MaxSize * 9 / 10)
+	}
+	return nil
+}
+
+// IsOffline tells whether the network must not be used.
+func (cache *Cache) IsOffline() bool {
+	return cache != nil && cache.Offline
+}
+
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (cache *Cache) files() []cacheFile {
+	files := []cacheFile{}
+	filepath.Walk(cache.Dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
+
+func (cache *Cache) measure() {
+	cache.size = 0
+	for _, f := range cache.files() {
+		cache.size += f.size
+	}
+}
+
+// evict removes the least recently written files until the cache is no
+// larger than limit.
+func (cache *Cache) evict(limit int64) error {
+	files := cache.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if cache.size <= limit {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		cache.size -= f.size
+		cache.stats.Evictions++
+	}
+	return nil
+}
+
+// Stats returns the counters of this process and the usage on disk.
+func (cache *Cache) Stats() CacheStats {
+	if cache == nil {
+		return CacheStats{}
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	stats := cache.stats
+	for _, f := range cache.files() {
+		stats.Entries++
+		stats.Size += f.size
+	}
+	return stats
+}
+
+func (stats CacheStats) String() string {
+	return fmt.Sprintf(`%d hits, %d misses (%d expired), %d writes, %d evictions; %d entries, %.1f MB on disk`,
+		stats.Hits, stats.Misses, stats.Expired, stats.Writes, stats.Evictions,
+		stats.Entries, float64(stats.Size)/(1<<20))
+}
+
+// Clear removes everything in the cache directory.
+func (cache *Cache) Clear() error {
+	if cache == nil {
+		return nil
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.size = 0
+	return os.RemoveAll(cache.Dir)
+}
+
+/*=======================================================
+/*                Cached client requests
+/*=======================================================*/
+
+// cached returns the data stored under kind/key or, on a miss, the body
+// of the response of fetch. Callers call store once they have parsed the
+// data successfully, so that error pages never end up in the cache.
+func (client *Client) cached(kind, key string, fetch func() (*http.Response, error)) (data []byte, status int, store func(), err error) {
+	if data, ok := client.Cache.Get(kind, key); ok {
+		return data, http.StatusOK, func() {}, nil
+	}
+	if client.Cache.IsOffline() {
+		return nil, 0, nil, fmt.Errorf(`%s %s: %w`, kind, key, ErrOffline)
+	}
+	res, err := fetch()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer res.Body.Close()
+	if data, err = ioutil.ReadAll(res.Body); err != nil {
+		return nil, 0, nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return data, res.StatusCode, func() {}, nil
+	}
+	return data, res.StatusCode, func() { client.Cache.Put(kind, key, data) }, nil
+}
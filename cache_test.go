@@ -0,0 +1,191 @@
+package termads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCache returns a cache in a temporary directory whose clock is
+// *now.
+func testCache(t *testing.T) (*Cache, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(t.TempDir())
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestCacheTTL(t *testing.T) {
+	cache, now := testCache(t)
+	cache.TTL[`forever`] = 0
+	for _, kind := range []string{CACHE_SEARCH, CACHE_ABSTRACT, `forever`} {
+		if err := cache.Put(kind, `key`, []byte(kind)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(kind string) bool {
+		data, ok := cache.Get(kind, `key`)
+		if ok && string(data) != kind {
+			t.Errorf(`Get(%s) = %q`, kind, data)
+		}
+		return ok
+	}
+	if !get(CACHE_SEARCH) || !get(CACHE_ABSTRACT) {
+		t.Error(`fresh entries missed`)
+	}
+	if _, ok := cache.Get(CACHE_SEARCH, `other`); ok {
+		t.Error(`a key never stored hit`)
+	}
+
+	*now = now.Add(25 * time.Hour)
+	if get(CACHE_SEARCH) {
+		t.Errorf(`a search hit after 25h, beyond its TTL of %v`, cache.TTL[CACHE_SEARCH])
+	}
+	if !get(CACHE_ABSTRACT) || !get(`forever`) {
+		t.Error(`entries within their TTL missed`)
+	}
+	*now = now.Add(100 * 24 * time.Hour)
+	if get(CACHE_ABSTRACT) || !get(`forever`) {
+		t.Error(`a TTL of 0 should never expire, the abstract TTL should`)
+	}
+
+	// storing again makes the entry fresh
+	cache.Put(CACHE_SEARCH, `key`, []byte(CACHE_SEARCH))
+	if !get(CACHE_SEARCH) {
+		t.Error(`a rewritten entry missed`)
+	}
+
+	stats := cache.Stats()
+	want := CacheStats{Hits: 6, Misses: 3, Expired: 2, Writes: 4, Entries: 3, Size: int64(len(`search` + `abstract` + `forever`))}
+	if stats != want {
+		t.Errorf("Stats() = %+v\nwant %+v", stats, want)
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	cache, now := testCache(t)
+	cache.Put(CACHE_SEARCH, `stale`, []byte(`old results`))
+	*now = now.Add(48 * time.Hour)
+
+	cache.Offline = true
+	if data, ok := cache.Get(CACHE_SEARCH, `stale`); !ok || string(data) != `old results` {
+		t.Errorf(`offline, stale data = %q, %v; want it served`, data, ok)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`fresh`))
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.Limiter = nil
+	client.Retry = nil
+	client.Cache = cache
+	fetch := func() (*http.Response, error) {
+		return client.get(context.Background(), server.URL)
+	}
+
+	// a miss offline never goes to the network
+	_, _, _, err := client.cached(CACHE_SEARCH, `missing`, fetch)
+	if !errors.Is(err, ErrOffline) || ExitCode(err) != EXIT_OFFLINE || requests != 0 {
+		t.Errorf(`offline miss: err = %v after %d requests`, err, requests)
+	}
+	data, status, _, err := client.cached(CACHE_SEARCH, `stale`, fetch)
+	if err != nil || status != http.StatusOK || string(data) != `old results` || requests != 0 {
+		t.Errorf(`offline hit = %q, %d, %v after %d requests`, data, status, err, requests)
+	}
+
+	// online, the stale entry is fetched again, and stored once parsed
+	cache.Offline = false
+	data, _, store, err := client.cached(CACHE_SEARCH, `stale`, fetch)
+	if err != nil || string(data) != `fresh` || requests != 1 {
+		t.Fatalf(`online = %q, %v after %d requests`, data, err, requests)
+	}
+	if data, _ := cache.Get(CACHE_SEARCH, `stale`); string(data) == `fresh` {
+		t.Error(`the response was stored before store was called`)
+	}
+	store()
+	if data, ok := cache.Get(CACHE_SEARCH, `stale`); !ok || string(data) != `fresh` {
+		t.Errorf(`after store = %q, %v`, data, ok)
+	}
+
+	// refresh mode misses but keeps storing
+	cache.Refresh = true
+	if _, ok := cache.Get(CACHE_SEARCH, `stale`); ok {
+		t.Error(`a hit in refresh mode`)
+	}
+	cache.Put(CACHE_SEARCH, `new`, []byte(`new`))
+	cache.Refresh = false
+	if data, ok := cache.Get(CACHE_SEARCH, `new`); !ok || string(data) != `new` {
+		t.Errorf(`stored in refresh mode = %q, %v`, data, ok)
+	}
+
+	var none *Cache
+	if none.IsOffline() || none.Put(CACHE_SEARCH, `key`, nil) != nil {
+		t.Error(`a nil cache should do nothing`)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache, now := testCache(t)
+	cache.MaxSize = 100
+	data := bytes.Repeat([]byte(`x`), 30)
+	for _, key := range []string{`a`, `b`, `c`} {
+		if err := cache.Put(CACHE_SEARCH, key, data); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(time.Minute)
+	}
+	// rewriting a key does not count twice, and makes it the newest
+	if err := cache.Put(CACHE_SEARCH, `a`, data); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Minute)
+	if stats := cache.Stats(); stats.Evictions != 0 || stats.Size != 90 {
+		t.Fatalf(`before eviction: %+v`, stats)
+	}
+
+	// 120 bytes: the oldest files go until 90% of MaxSize is left
+	if err := cache.Put(CACHE_ABSTRACT, `d`, data); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{`a`: true, `b`: false, `c`: true} {
+		if _, ok := cache.Get(CACHE_SEARCH, key); ok != want {
+			t.Errorf(`after eviction, %s cached = %v, want %v`, key, ok, want)
+		}
+	}
+	if _, ok := cache.Get(CACHE_ABSTRACT, `d`); !ok {
+		t.Error(`the new entry was evicted`)
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 3 || stats.Size != 90 {
+		t.Errorf(`after eviction: %+v`, stats)
+	}
+
+	// a new cache measures what is on disk first
+	reopened := NewCache(cache.Dir)
+	reopened.MaxSize = 100
+	reopened.now = cache.now
+	*now = now.Add(time.Minute)
+	if err := reopened.Put(CACHE_SEARCH, `e`, data); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get(CACHE_SEARCH, `c`); ok {
+		t.Error(`the oldest entry survived in the reopened cache`)
+	}
+	if stats := reopened.Stats(); stats.Evictions != 1 || stats.Size != 90 {
+		t.Errorf(`reopened: %+v`, stats)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 || !strings.Contains(stats.String(), `0 entries`) {
+		t.Errorf(`after Clear: %v`, stats)
+	}
+}
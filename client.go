@@ -1,108 +1,550 @@
 package termads
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 const (
-	ADS_ABS_URL    = `http://adsabs.harvard.edu/cgi-bin/nph-abs_connect`
-	ADS_BIB_URL    = `http://adsabs.harvard.edu/cgi-bin/nph-bib_query`
-	ABSTAG_BEFORE  = `Abstract</h3>`
-	ABSTAG_AFTER   = `<hr/>`
-	SEARCH_PATTERN = `(?m)` + ABSTAG_BEFORE + `[\s\S]*?` + ABSTAG_AFTER
+	ADS_ABS_URL         = `http://adsabs.harvard.edu/cgi-bin/nph-abs_connect`
+	ADS_BIB_URL         = `http://adsabs.harvard.edu/cgi-bin/nph-bib_query`
+	ADS_CLASSIC_ABS_URL = `http://adsabs.harvard.edu/abs/`
+	ABSTAG_BEFORE       = `Abstract</h3>`
+	ABSTAG_AFTER        = `<hr/>`
+	SEARCH_PATTERN      = `(?m)` + ABSTAG_BEFORE + `[\s\S]*?` + ABSTAG_AFTER
+	DEFAULT_USER_AGENT  = `termads (+https://github.com/yurutaso/termads)`
 )
 
-func GetPapers(form *Form) ([]Paper, error) {
-	fmt.Printf("Waiting for response from ADS.\n")
-	res, err := http.PostForm(ADS_ABS_URL, form.values)
+// Backend is the set of network operations used by the package.
+type Backend interface {
+	GetPageContext(ctx context.Context, form *Form) ([]Paper, int, error)
+	GetAbstractContext(ctx context.Context, _url string) (string, error)
+	GetBibTexContext(ctx context.Context, bibcode string) (string, error)
+	GetBibTexBatchContext(ctx context.Context, bibcodes []string) (map[string]string, []string, error)
+	GetLinkedPapersContext(ctx context.Context, p Paper, linktype string) ([]Paper, error)
+}
+
+// Client talks to ADS. With an empty Token it uses the classic CGI
+// interface, otherwise the v1 JSON API.
+type Client struct {
+	AbsURL     string
+	BibURL     string
+	APIURL     string
+	ExportURL  string
+	HTTPClient *http.Client
+	UserAgent  string
+	Token      string
+	Cache      *Cache       // nil disables caching
+	Limiter    *RateLimiter // nil disables throttling
+	Retry      *RetryPolicy // nil disables retries
+
+	quota *quotaTracker
+}
+
+var DefaultClient = NewClient()
+
+func NewClient() *Client {
+	retry := DEFAULT_RETRY
+	return &Client{
+		AbsURL:     ADS_ABS_URL,
+		BibURL:     ADS_BIB_URL,
+		APIURL:     ADS_API_URL,
+		ExportURL:  ADS_EXPORT_URL,
+		HTTPClient: http.DefaultClient,
+		UserAgent:  DEFAULT_USER_AGENT,
+		Limiter:    NewRateLimiter(DEFAULT_RATE_LIMIT, DEFAULT_RATE_BURST),
+		Retry:      &retry,
+		quota:      &quotaTracker{},
+	}
+}
+
+func (client *Client) NewPaper() Paper {
+	p := NewPaper().(*paper)
+	p.client = client
+	return p
+}
+
+func (client *Client) do(req *http.Request) (*http.Response, error) {
+	if client.UserAgent != "" {
+		req.Header.Set(`User-Agent`, client.UserAgent)
+	}
+	if client.Token != "" {
+		req.Header.Set(`Authorization`, `Bearer `+client.Token)
+	}
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return client.send(httpClient, req)
+}
+
+func (client *Client) get(ctx context.Context, _url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, `GET`, _url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
+	return client.do(req)
+}
 
-	fmt.Printf("Extracting papers from response.\n")
-	doc, err := goquery.NewDocumentFromResponse(res)
+func (client *Client) postForm(ctx context.Context, _url string, values url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, `POST`, _url, strings.NewReader(values.Encode()))
 	if err != nil {
 		return nil, err
 	}
-	return GetPapersFromDocument(doc)
+	req.Header.Set(`Content-Type`, `application/x-www-form-urlencoded`)
+	return client.do(req)
 }
 
-func GetPapersFromDocument(doc *goquery.Document) ([]Paper, error) {
-	// Get bibcodes
-	bibcodes_str, _ := doc.Find("form > input").Attr("value")
-	bibcodes := strings.Split(bibcodes_str, ";")
-
-	// Get links for each bibcode
-	table := doc.Find("form > table").Eq(1)
-	papers := make([]Paper, len(bibcodes), len(bibcodes))
-	cnt := 0
-	table.Find("tbody>tr").Each(func(i int, s *goquery.Selection) {
-		// Links
-		if i > 0 && i%3 == 0 {
-			papers[cnt] = NewPaper()
-			linktypes := s.Find("td").Last().Find("a")
-			papers[cnt].SetBibcode(bibcodes[cnt])
-			linktypes.Each(func(_ int, s *goquery.Selection) {
-				link, _ := s.Attr("href")
-				papers[cnt].SetURL(link, s.Text())
-			})
-		}
-		// Authors and Titles
-		if i > 1 && i%3 == 1 {
-			td := s.Find("td")
-			authors := td.Eq(1).Text()
-			title := td.Eq(3).Text()
-			papers[cnt].SetAuthors(authors)
-			papers[cnt].SetTitle(title)
-			cnt++
+func (client *Client) GetPapers(form *Form) ([]Paper, error) {
+	return client.GetPapersContext(context.Background(), form)
+}
+
+func (client *Client) GetPapersContext(ctx context.Context, form *Form) ([]Paper, error) {
+	papers, _, err := client.GetPageContext(ctx, form)
+	return papers, err
+}
+
+// GetPage returns one window (start_nr, nr_to_return) of the result and
+// the total number of hits, or -1 if ADS did not report it.
+func (client *Client) GetPage(form *Form) ([]Paper, int, error) {
+	return client.GetPageContext(context.Background(), form)
+}
+
+func (client *Client) GetPageContext(ctx context.Context, form *Form) ([]Paper, int, error) {
+	if client.Token != "" {
+		return client.getPageFromAPI(ctx, form)
+	}
+	if form.query != nil {
+		return nil, -1, &FieldError{Field: `query`, Value: form.query.String(), Reason: `requires the ADS API (set a token)`}
+	}
+	body, status, store, err := client.cached(CACHE_SEARCH, client.AbsURL+`?`+form.values.Encode(), func() (*http.Response, error) {
+		return client.postForm(ctx, client.AbsURL, form.values)
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+	if status != http.StatusOK {
+		return nil, -1, &StatusError{Code: status}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, -1, err
+	}
+	papers, err := client.GetPapersFromDocument(doc)
+	if err == nil {
+		store()
+	}
+	return papers, totalFromDocument(doc), err
+}
+
+func (client *Client) GetPapersFromAPI(form *Form) ([]Paper, error) {
+	papers, _, err := client.getPageFromAPI(context.Background(), form)
+	return papers, err
+}
+
+func (client *Client) getPageFromAPI(ctx context.Context, form *Form) ([]Paper, int, error) {
+	_url := client.APIURL + `?` + form.APIValues().Encode()
+	data, status, store, err := client.cached(CACHE_SEARCH, _url, func() (*http.Response, error) {
+		return client.get(ctx, _url)
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+
+	var body apiResponse
+	if err := json.Unmarshal(data, &body); err != nil {
+		if status != http.StatusOK {
+			return nil, -1, &StatusError{Code: status}
+		}
+		return nil, -1, &ParseError{What: `ADS API response`, Msg: err.Error(), Snippet: snippet(string(data), 0)}
+	}
+	if body.Error != nil {
+		return nil, -1, &StatusError{Code: status, Msg: body.Error.Msg}
+	}
+	if status != http.StatusOK {
+		return nil, -1, &StatusError{Code: status}
+	}
+	store()
+	return client.papersFromAPIResponse(&body), body.Response.NumFound, nil
+}
+
+// ResultPageError reports the records of a result page that could not
+// be read completely. Records with a usable bibcode are still returned
+// along with it; the others are left out.
+type ResultPageError struct {
+	Warnings []*ParseError
+	Records  int // records on the page, including the broken ones
+}
+
+func (e *ResultPageError) Error() string {
+	return fmt.Sprintf(`%d problems with the %d records of the result page, first: %v`,
+		len(e.Warnings), e.Records, e.Warnings[0])
+}
+
+func (e *ResultPageError) Unwrap() error {
+	return e.Warnings[0]
+}
+
+// GetPapersFromDocument reads the result table of the classic interface.
+// Each record starts at the row holding its bibcode checkbox (or the
+// link to its abstract page); the score, date and links are read from
+// that row, the authors and title from the next row with text. Broken
+// records are reported by a *ResultPageError.
+func (client *Client) GetPapersFromDocument(doc *goquery.Document) ([]Paper, error) {
+	// innermost rows only, in case the table is nested in a layout table
+	rows := doc.Find(`tr`).FilterFunction(func(_ int, tr *goquery.Selection) bool {
+		return tr.Find(`tr`).Length() == 0
+	})
+	markers := []int{}
+	rows.Each(func(i int, tr *goquery.Selection) {
+		if _, ok := recordBibcode(tr); ok {
+			markers = append(markers, i)
 		}
 	})
+
+	// bibcodes of the page, used to tell missing records
+	listed := []string{}
+	if s, ok := doc.Find(`form > input[type=hidden]`).Attr(`value`); ok && s != `` {
+		listed = strings.Split(s, `;`)
+	}
+	if len(markers) == 0 && len(listed) == 0 {
+		if totalFromDocument(doc) == 0 {
+			return []Paper{}, nil
+		}
+		return nil, &ParseError{What: `result page`, Msg: `no records`, Snippet: snippet(doc.Find(`body`).Text(), 0)}
+	}
+
+	papers := []Paper{}
+	warnings := []*ParseError{}
+	found := map[string]bool{}
+	for n, i := range markers {
+		next := rows.Length()
+		if n+1 < len(markers) {
+			next = markers[n+1]
+		}
+		tr := rows.Eq(i)
+		warn := func(msg string) {
+			warnings = append(warnings, &ParseError{What: fmt.Sprintf(`result record %d`, n+1), Msg: msg, Snippet: snippet(rowText(tr), 0)})
+		}
+		bibcode, _ := recordBibcode(tr)
+		if len(bibcode) != BIBCODE_LENGTH {
+			warn(fmt.Sprintf(`bibcode "%s" is not %d characters`, bibcode, BIBCODE_LENGTH))
+			continue
+		}
+		found[bibcode] = true
+
+		p := client.NewPaper()
+		p.SetBibcode(bibcode)
+		setScoreAndDate(p.Metadata(), tr.Find(`td`))
+		tr.Find(`a`).Each(func(_ int, a *goquery.Selection) {
+			linktype := strings.TrimSpace(a.Text())
+			if link, ok := a.Attr(`href`); ok && len(linktype) == 1 {
+				p.SetURL(link, linktype)
+			}
+		})
+		if authors, title, ok := recordAuthorsAndTitle(rows.Slice(i+1, next)); ok {
+			p.SetAuthors(authors)
+			p.SetTitle(title)
+		} else {
+			warn(`no authors and title`)
+		}
+		papers = append(papers, p)
+	}
+	for _, bibcode := range listed {
+		if !found[bibcode] {
+			warnings = append(warnings, &ParseError{What: `result page`, Msg: fmt.Sprintf(`no record for %s`, bibcode)})
+		}
+	}
+
+	if len(warnings) > 0 {
+		records := len(markers)
+		if len(listed) > records {
+			records = len(listed)
+		}
+		return papers, &ResultPageError{Warnings: warnings, Records: records}
+	}
 	return papers, nil
 }
 
-func GetAbstract(_url string) (string, error) {
-	res, err := http.Get(_url)
+// recordBibcode returns the bibcode of the record starting at tr.
+func recordBibcode(tr *goquery.Selection) (string, bool) {
+	if value, ok := tr.Find(`input[type=checkbox][name=bibcode]`).Attr(`value`); ok {
+		return strings.TrimSpace(value), true
+	}
+	var bibcode string
+	tr.Find(`a[href*="/abs/"]`).EachWithBreak(func(_ int, a *goquery.Selection) bool {
+		bibcode = strings.TrimSpace(a.Text())
+		return len(bibcode) != BIBCODE_LENGTH
+	})
+	return bibcode, len(bibcode) == BIBCODE_LENGTH
+}
+
+// rowText joins the text of the cells of tr by spaces.
+func rowText(tr *goquery.Selection) string {
+	return strings.Join(tr.Find(`td`).Map(func(_ int, td *goquery.Selection) string {
+		return td.Text()
+	}), ` `)
+}
+
+// recordAuthorsAndTitle reads the first of rows with text: its first
+// non-empty cell holds the authors, the last one the title.
+func recordAuthorsAndTitle(rows *goquery.Selection) (authors, title string, ok bool) {
+	rows.EachWithBreak(func(_ int, tr *goquery.Selection) bool {
+		cells := []string{}
+		tr.Find(`td`).Each(func(_ int, td *goquery.Selection) {
+			if text := strings.TrimSpace(td.Text()); text != `` {
+				cells = append(cells, text)
+			}
+		})
+		if len(cells) == 0 {
+			return true
+		}
+		if len(cells) >= 2 {
+			authors, title, ok = cells[0], cells[len(cells)-1], true
+		}
+		return false
+	})
+	return authors, title, ok
+}
+
+var (
+	scorePattern = regexp.MustCompile(`^\d+\.\d+$`)
+	datePattern  = regexp.MustCompile(`^\d{2}/\d{4}$`)
+)
+
+// setScoreAndDate picks the score ("1.000") and date ("05/2019") cells
+// of a result row.
+func setScoreAndDate(meta *Metadata, cells *goquery.Selection) {
+	cells.Each(func(_ int, td *goquery.Selection) {
+		text := strings.TrimSpace(td.Text())
+		switch {
+		case scorePattern.MatchString(text):
+			meta.Score, _ = strconv.ParseFloat(text, 64)
+		case datePattern.MatchString(text):
+			meta.SetPubDate(text)
+		}
+	})
+}
+
+var totalPattern = regexp.MustCompile(`(?i)total number selected:\s*([\d,]+)`)
+
+// totalFromDocument reads "Total number selected: N" from a result page.
+func totalFromDocument(doc *goquery.Document) int {
+	m := totalPattern.FindStringSubmatch(doc.Find("body").Text())
+	if m == nil {
+		return -1
+	}
+	total, err := strconv.Atoi(strings.Replace(m[1], `,`, ``, -1))
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+func (client *Client) GetAbstract(_url string) (string, error) {
+	return client.GetAbstractContext(context.Background(), _url)
+}
+
+func (client *Client) GetAbstractContext(ctx context.Context, _url string) (string, error) {
+	body, status, store, err := client.cached(CACHE_ABSTRACT, _url, func() (*http.Response, error) {
+		return client.get(ctx, _url)
+	})
 	if err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
+	if status != http.StatusOK {
+		return "", &StatusError{Code: status}
+	}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
 	r := regexp.MustCompile(SEARCH_PATTERN)
-	s, err := doc.Find("body").Html()
-	s = r.FindString(s)
+	html, err := doc.Find("body").Html()
+	if err != nil {
+		return "", err
+	}
+	s := r.FindString(html)
+	if s == "" {
+		return "", &ParseError{What: `abstract page`, Msg: `no abstract section`, Snippet: snippet(doc.Find("body").Text(), 0)}
+	}
 	// Trim unnecessary chars before&after abstract
-	s = strings.Split(s, ABSTAG_BEFORE)[1]
-	s = s[0 : len(s)-5]
+	s = strings.TrimSuffix(strings.TrimPrefix(s, ABSTAG_BEFORE), ABSTAG_AFTER)
+	store()
 	return s, nil
 }
 
-func GetBibTex(bibcode string) (string, error) {
+func (client *Client) GetBibTex(bibcode string) (string, error) {
+	return client.GetBibTexContext(context.Background(), bibcode)
+}
+
+func (client *Client) GetBibTexContext(ctx context.Context, bibcode string) (string, error) {
+	normalized, err := NormalizeBibcode(bibcode)
+	if err != nil {
+		return "", err
+	}
+	if client.Token != "" {
+		entries, missing, err := client.GetBibTexBatchContext(ctx, []string{bibcode})
+		if err != nil {
+			return "", err
+		}
+		if len(missing) > 0 {
+			return "", fmt.Errorf(`no BibTeX entry for %s: %w`, bibcode, ErrNotFound)
+		}
+		return entries[bibcode], nil
+	}
+	// the same key as GetBibTexBatchContext, whatever the spelling
+	key := `bibtex ` + normalized
+	if data, ok := client.Cache.Get(CACHE_EXPORT, key); ok {
+		return string(data), nil
+	}
+	if client.Cache.IsOffline() {
+		return "", fmt.Errorf(`BibTeX of %s: %w`, bibcode, ErrOffline)
+	}
 	values := url.Values{}
-	values.Add(`bibcode`, bibcode)
+	values.Add(`bibcode`, normalized)
 	values.Add(`data_type`, `BIBTEX`)
 	values.Add(`db_key`, `AST`)
 	values.Add(`nocookieset`, `1`)
-	res, err := http.PostForm(ADS_BIB_URL, values)
+	res, err := client.postForm(ctx, client.BibURL, values)
 	if err != nil {
 		return "", err
 	}
 	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", &StatusError{Code: res.StatusCode}
+	}
 
 	doc, err := goquery.NewDocumentFromResponse(res)
 	if err != nil {
 		return "", err
 	}
 
-	bibtex := `@` + strings.TrimSpace(strings.Split(doc.Find("body").Text(), `@`)[1])
-	return bibtex, nil
+	file, err := ParseBibTex(doc.Find("body").Text())
+	if err != nil {
+		return "", err
+	}
+	entries := file.Entries()
+	if len(entries) == 0 {
+		return "", fmt.Errorf(`no BibTeX entry for %s: %w`, bibcode, ErrNotFound)
+	}
+	client.Cache.Put(CACHE_EXPORT, key, []byte(entries[0].String()))
+	return entries[0].String(), nil
+}
+
+// GetPaper returns the paper with the given bibcode. The classic
+// interface cannot search by bibcode, so without a token the title,
+// authors and year are taken from the BibTeX entry.
+func (client *Client) GetPaper(bibcode string) (Paper, error) {
+	return client.GetPaperContext(context.Background(), bibcode)
+}
+
+func (client *Client) GetPaperContext(ctx context.Context, bibcode string) (Paper, error) {
+	bibcode, err := NormalizeBibcode(bibcode)
+	if err != nil {
+		return nil, err
+	}
+	if client.Token != "" {
+		form := NewForm()
+		form.SetAPIQuery(Field(`bibcode`, bibcode))
+		if err := form.SetPage(1, 1); err != nil {
+			return nil, err
+		}
+		papers, _, err := client.GetPageContext(ctx, form)
+		if err != nil {
+			return nil, err
+		}
+		if len(papers) == 0 {
+			return nil, fmt.Errorf(`%s: %w`, bibcode, ErrNotFound)
+		}
+		return papers[0], nil
+	}
+
+	text, err := client.GetBibTexContext(ctx, bibcode)
+	if err != nil {
+		return nil, err
+	}
+	file, err := ParseBibTex(text)
+	if err != nil {
+		return nil, err
+	}
+	p := client.NewPaper()
+	p.SetBibcode(bibcode)
+	p.SetURL(ADS_CLASSIC_ABS_URL+bibcode, LINKTYPE_ABSTRACT)
+	if entries := file.Entries(); len(entries) > 0 {
+		entry := entries[0]
+		p.SetTitle(plainBibText(entry.Get(`title`)))
+		authors := []Person{}
+		for _, name := range entry.Authors() {
+			authors = append(authors, ParseAuthor(plainBibText(name)))
+		}
+		p.SetAuthorList(authors)
+		p.Metadata().SetPubDate(entry.Get(`year`))
+		p.Metadata().DOI = entry.DOI()
+		p.Metadata().ArXivID = entry.ArXivID()
+	}
+	return p, nil
+}
+
+var plainBibReplacer = strings.NewReplacer(`{`, ``, `}`, ``, `~`, ` `)
+
+// plainBibText drops the braces and ties of a BibTeX value.
+func plainBibText(s string) string {
+	return strings.Join(strings.Fields(plainBibReplacer.Replace(s)), ` `)
+}
+
+/*=======================================================
+/*           Wrappers around DefaultClient
+/*=======================================================*/
+
+func GetPapers(form *Form) ([]Paper, error) {
+	return DefaultClient.GetPapers(form)
+}
+
+func GetPapersContext(ctx context.Context, form *Form) ([]Paper, error) {
+	return DefaultClient.GetPapersContext(ctx, form)
+}
+
+func GetPapersFromAPI(form *Form, token string) ([]Paper, error) {
+	client := *DefaultClient
+	client.Token = token
+	return client.GetPapersFromAPI(form)
+}
+
+func GetPapersFromDocument(doc *goquery.Document) ([]Paper, error) {
+	return DefaultClient.GetPapersFromDocument(doc)
+}
+
+func GetPaper(bibcode string) (Paper, error) {
+	return DefaultClient.GetPaper(bibcode)
+}
+
+func GetPaperContext(ctx context.Context, bibcode string) (Paper, error) {
+	return DefaultClient.GetPaperContext(ctx, bibcode)
+}
+
+func GetAbstract(_url string) (string, error) {
+	return DefaultClient.GetAbstract(_url)
+}
+
+func GetAbstractContext(ctx context.Context, _url string) (string, error) {
+	return DefaultClient.GetAbstractContext(ctx, _url)
+}
+
+func GetBibTex(bibcode string) (string, error) {
+	return DefaultClient.GetBibTex(bibcode)
+}
+
+func GetBibTexContext(ctx context.Context, bibcode string) (string, error) {
+	return DefaultClient.GetBibTexContext(ctx, bibcode)
 }
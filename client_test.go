@@ -0,0 +1,122 @@
+package termads
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+The pages under testdata were recorded from the classic interface with
+cmd/ads_fixture, which also wrote the golden files. The tests serve each
+page from a local server and compare what the scraper makes of it.
+*/
+
+// fixtureClient returns a client of the classic interface that gets
+// testdata/name.html for every request.
+func fixtureClient(t *testing.T, name string) (*Client, *httptest.Server) {
+	t.Helper()
+	page, err := ioutil.ReadFile(filepath.Join(`testdata`, name+`.html`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `text/html`)
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+	client := NewClient()
+	client.AbsURL = server.URL
+	client.BibURL = server.URL
+	client.Limiter = nil
+	client.Retry = nil
+	return client, server
+}
+
+func TestScraper(t *testing.T) {
+	tests := []struct {
+		name    string
+		scrape  func(client *Client, url string) (Golden, error)
+		wantErr error
+	}{
+		{name: `results_kennicutt`, scrape: scrapeResults},
+		{name: `results_empty`, scrape: scrapeResults},
+		// records without authors and title are kept with a warning
+		{name: `results_broken`, scrape: scrapeResults, wantErr: ErrParse},
+		{name: `abstract_1998ApJ_498_541K`, scrape: scrapeAbstract},
+		{name: `abstract_missing`, scrape: scrapeAbstract, wantErr: ErrParse},
+		{name: `bibtex_1998ApJ_498_541K`, scrape: scrapeBibTex(`1998ApJ...498..541K`)},
+		{name: `bibtex_missing`, scrape: scrapeBibTex(`1998ApJ...498..541K`), wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := fixtureClient(t, tt.name)
+			got, err := tt.scrape(client, server.URL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf(`err = %v, want %v`, err, tt.wantErr)
+			}
+			if err != nil {
+				got.Error = err.Error()
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(`testdata`, tt.name+`.golden`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want Golden
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.MarshalIndent(got, ``, "\t")
+				t.Errorf("got\n%s\nwant\n%s", gotJSON, data)
+			}
+		})
+	}
+}
+
+func scrapeResults(client *Client, url string) (Golden, error) {
+	papers, total, err := client.GetPage(NewForm())
+	g := Golden{Total: &total}
+	for _, p := range papers {
+		g.Papers = append(g.Papers, NewGoldenPaper(p))
+	}
+	return g, err
+}
+
+func scrapeAbstract(client *Client, url string) (Golden, error) {
+	abstract, err := client.GetAbstract(url)
+	return Golden{Abstract: abstract}, err
+}
+
+func scrapeBibTex(bibcode string) func(*Client, string) (Golden, error) {
+	return func(client *Client, url string) (Golden, error) {
+		bibtex, err := client.GetBibTex(bibcode)
+		return Golden{BibTex: bibtex}, err
+	}
+}
+
+// TestResultPageError checks that the broken records of a result page
+// are reported one by one and the readable ones keep their own links.
+func TestResultPageError(t *testing.T) {
+	client, _ := fixtureClient(t, `results_broken`)
+	papers, _, err := client.GetPage(NewForm())
+	var perr *ResultPageError
+	if !errors.As(err, &perr) {
+		t.Fatalf(`err = %#v, want a *ResultPageError`, err)
+	}
+	if perr.Records != 4 || len(perr.Warnings) != 4 {
+		t.Errorf(`%d warnings for %d records, want 4 for 4`, len(perr.Warnings), perr.Records)
+	}
+	for _, p := range papers {
+		if url := p.GetURLOfType(LINKTYPE_ABSTRACT); !strings.Contains(url, p.GetBibcode()) {
+			t.Errorf(`%s has the abstract link %s`, p.GetBibcode(), url)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/yurutaso/termads"
+	"os"
+	"os/signal"
+	"sort"
+)
+
+var (
+	bib = flag.String("bib", "", ".bib file to update (default: the first \\bibliography of the project)")
+	dry = flag.Bool("n", false, "only report, do not fetch or write anything")
+	tok = flag.String("token", termads.APIToken(), "ADS API token (needed to resolve arXiv ids and DOIs)")
+
+	refresh = flag.Bool("refresh", false, "ignore cached responses and fetch them again")
+	offline = flag.Bool("offline", false, "use cached responses only")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] main.tex\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(termads.EXIT_USAGE)
+	}
+
+	project, err := termads.ScanLaTeX(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	target := *bib
+	if target == "" {
+		if len(project.Bibliographies) == 0 {
+			fmt.Fprintln(os.Stderr, "no \\bibliography in the project; use -bib")
+			os.Exit(termads.EXIT_USAGE)
+		}
+		target = project.Bibliographies[0]
+	}
+
+	// keys already defined in any of the project's .bib files
+	defined := map[string]bool{}
+	for _, path := range append(project.Bibliographies, target) {
+		file, err := termads.ReadBibFile(path)
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", path, err))
+		}
+		for _, entry := range file.Entries() {
+			defined[entry.Key] = true
+		}
+	}
+	missing := []string{}
+	for _, key := range project.Keys() {
+		if !defined[key] {
+			missing = append(missing, key)
+		}
+	}
+	fmt.Printf("%d files, %d cited keys, %d missing from the bibliography.\n",
+		len(project.Files), len(project.Keys()), len(missing))
+	if len(missing) == 0 {
+		return
+	}
+
+	unresolved := map[string]error{}
+	if *dry {
+		for _, key := range missing {
+			if kind, id := termads.ParseIdentifier(key); kind != "" {
+				fmt.Printf("would fetch %s (%s %s)\n", key, kind, id)
+			} else {
+				unresolved[key] = &termads.FieldError{Field: "cite key", Value: key, Reason: "not a bibcode, arXiv id or DOI"}
+			}
+		}
+	} else {
+		client := termads.NewClient()
+		client.Token = *tok
+		client.Cache = termads.NewCache(termads.DefaultCacheDir())
+		client.Cache.Refresh = *refresh
+		client.Cache.Offline = *offline
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		entries, failed, err := client.ResolveCiteKeysContext(ctx, missing)
+		if err != nil {
+			fatal(err)
+		}
+		unresolved = failed
+		if len(entries) > 0 {
+			file, err := termads.ReadBibFile(target)
+			if err != nil {
+				fatal(err)
+			}
+			for _, entry := range entries {
+				file.Add(entry)
+				fmt.Printf("added    %s\n", entry.Key)
+			}
+			if err := termads.WriteBibFile(target, file); err != nil {
+				fatal(err)
+			}
+			fmt.Printf("%d entries written to %s.\n", len(entries), target)
+		}
+	}
+
+	if len(unresolved) == 0 {
+		return
+	}
+	keys := []string{}
+	for key := range unresolved {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(os.Stderr, "%d unresolved keys:\n", len(keys))
+	for _, key := range keys {
+		for _, c := range project.Citations {
+			if c.Key == key {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s: %v\n", c.File, c.Line, key, unresolved[key])
+				break
+			}
+		}
+	}
+	os.Exit(termads.EXIT_NOT_FOUND)
+}
+
+// fatal prints err with a hint on what to do and exits with the code
+// matching the error.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	if hint := termads.ErrorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, "hint: "+hint)
+	}
+	os.Exit(termads.ExitCode(err))
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/yurutaso/termads"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ads_fixture keeps the scraper of the classic ADS interface honest.
+
+	ads_fixture check [-update]
+		serves each saved page under testdata from a local server, runs
+		the scraper on it and compares the result with NAME.golden; go test
+		does the same for the fixtures listed in client_test.go
+
+	ads_fixture record results NAME key=value...
+	ads_fixture record abstract NAME URL
+	ads_fixture record bibtex NAME BIBCODE
+		fetches a page from ADS, saves it as NAME.html and writes its
+		golden file, to be reviewed before committing
+*/
+
+const (
+	KIND_RESULTS  = `results`
+	KIND_ABSTRACT = `abstract`
+	KIND_BIBTEX   = `bibtex`
+	MANIFEST      = `fixtures.json`
+)
+
+var (
+	dir    = flag.String("dir", "testdata", "directory of the fixtures")
+	update = flag.Bool("update", false, "check: rewrite the golden files instead of comparing")
+)
+
+// Fixture is an entry of testdata/fixtures.json. Arg is the form values
+// (URL-encoded), URL or bibcode the page was recorded with.
+type Fixture struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Arg  string `json:"arg"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] check\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] record results|abstract|bibtex NAME ARG...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var err error
+	switch flag.Arg(0) {
+	case "check":
+		err = check()
+	case "record":
+		if flag.NArg() < 4 {
+			flag.Usage()
+			os.Exit(termads.EXIT_USAGE)
+		}
+		fixture := Fixture{Kind: flag.Arg(1), Name: flag.Arg(2), Arg: flag.Arg(3)}
+		if fixture.Kind == KIND_RESULTS {
+			fixture.Arg, err = formValues(flag.Args()[3:])
+		}
+		if err == nil {
+			err = record(fixture)
+		}
+	default:
+		flag.Usage()
+		os.Exit(termads.EXIT_USAGE)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		os.Exit(termads.ExitCode(err))
+	}
+}
+
+/*=======================================================
+/*                    Checking
+/*=======================================================*/
+
+func check() error {
+	fixtures, err := readManifest()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, fixture := range fixtures {
+		page, err := ioutil.ReadFile(fixture.path(`.html`))
+		if err != nil {
+			return err
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(`Content-Type`, `text/html`)
+			w.Write(page)
+		}))
+		client := termads.NewClient()
+		client.AbsURL = server.URL
+		client.BibURL = server.URL
+		client.Limiter = nil
+		client.Retry = nil
+		got, err := scrape(client, fixture, server.URL)
+		server.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", fixture.Name, err)
+		}
+
+		if *update {
+			if err := ioutil.WriteFile(fixture.path(`.golden`), got, 0644); err != nil {
+				return err
+			}
+			fmt.Printf("updated %s\n", fixture.Name)
+			continue
+		}
+		want, err := ioutil.ReadFile(fixture.path(`.golden`))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(got, want) {
+			fmt.Printf("ok      %s\n", fixture.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL    %s\n%s", fixture.Name, diff(string(want), string(got)))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed", failed, len(fixtures))
+	}
+	return nil
+}
+
+// scrape runs the scraper for the kind of fixture and returns the golden
+// JSON. abstractURL is where the abstract page is served. Errors of the
+// scraper are part of the result; the returned error is for everything
+// else.
+func scrape(client *termads.Client, fixture Fixture, abstractURL string) ([]byte, error) {
+	var (
+		golden termads.Golden
+		err    error
+	)
+	switch fixture.Kind {
+	case KIND_RESULTS:
+		var (
+			papers []termads.Paper
+			total  int
+		)
+		papers, total, err = client.GetPage(termads.NewForm())
+		golden.Total = &total
+		for _, p := range papers {
+			golden.Papers = append(golden.Papers, termads.NewGoldenPaper(p))
+		}
+	case KIND_ABSTRACT:
+		golden.Abstract, err = client.GetAbstract(abstractURL)
+	case KIND_BIBTEX:
+		golden.BibTex, err = client.GetBibTex(fixture.Arg)
+	default:
+		return nil, &termads.FieldError{Field: "fixture kind", Value: fixture.Kind, Reason: "must be results, abstract or bibtex"}
+	}
+	if err != nil {
+		golden.Error = err.Error()
+	}
+	data, err := json.MarshalIndent(golden, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// diff shows the lines of want and got from the first one that differs.
+func diff(want, got string) string {
+	w := strings.Split(want, "\n")
+	g := strings.Split(got, "\n")
+	for i := 0; i < len(w) || i < len(g); i++ {
+		if i < len(w) && i < len(g) && w[i] == g[i] {
+			continue
+		}
+		s := fmt.Sprintf("\tline %d:\n", i+1)
+		if i < len(w) {
+			s += fmt.Sprintf("\t- %s\n", w[i])
+		}
+		if i < len(g) {
+			s += fmt.Sprintf("\t+ %s\n", g[i])
+		}
+		return s
+	}
+	return ""
+}
+
+/*=======================================================
+/*                    Recording
+/*=======================================================*/
+
+// recorder keeps the body of the last response.
+type recorder struct {
+	body []byte
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	r.body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(r.body))
+	return res, nil
+}
+
+func record(fixture Fixture) error {
+	rec := &recorder{}
+	client := termads.NewClient()
+	client.HTTPClient = &http.Client{Transport: rec}
+
+	var err error
+	switch fixture.Kind {
+	case KIND_RESULTS:
+		values, perr := url.ParseQuery(fixture.Arg)
+		if perr != nil {
+			return perr
+		}
+		form := termads.NewForm()
+		for key := range values {
+			if err := form.Set(key, values.Get(key)); err != nil {
+				return err
+			}
+		}
+		_, _, err = client.GetPage(form)
+	case KIND_ABSTRACT:
+		_, err = client.GetAbstract(fixture.Arg)
+	case KIND_BIBTEX:
+		_, err = client.GetBibTex(fixture.Arg)
+	default:
+		return &termads.FieldError{Field: "fixture kind", Value: fixture.Kind, Reason: "must be results, abstract or bibtex"}
+	}
+	if rec.body == nil {
+		return err
+	}
+	if err != nil {
+		// pages the scraper fails on are worth keeping too
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	if err := ioutil.WriteFile(fixture.path(`.html`), rec.body, 0644); err != nil {
+		return err
+	}
+
+	// the golden file is made offline from the saved page, as check does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(rec.body)
+	}))
+	defer server.Close()
+	offline := termads.NewClient()
+	offline.AbsURL = server.URL
+	offline.BibURL = server.URL
+	golden, err := scrape(offline, fixture, server.URL)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fixture.path(`.golden`), golden, 0644); err != nil {
+		return err
+	}
+	if err := addToManifest(fixture); err != nil {
+		return err
+	}
+	fmt.Printf("recorded %s; review %s before committing it\n", fixture.Name, fixture.path(`.golden`))
+	return nil
+}
+
+// formValues encodes key=value arguments.
+func formValues(args []string) (string, error) {
+	values := url.Values{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return "", &termads.FieldError{Field: "form value", Value: arg, Reason: "must be key=value"}
+		}
+		values.Set(kv[0], kv[1])
+	}
+	return values.Encode(), nil
+}
+
+/*=======================================================
+/*                    Manifest
+/*=======================================================*/
+
+func (fixture Fixture) path(ext string) string {
+	return filepath.Join(*dir, fixture.Name+ext)
+}
+
+func readManifest() ([]Fixture, error) {
+	data, err := ioutil.ReadFile(filepath.Join(*dir, MANIFEST))
+	if os.IsNotExist(err) {
+		return []Fixture{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fixtures := []Fixture{}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, &termads.ParseError{What: MANIFEST, Msg: err.Error()}
+	}
+	return fixtures, nil
+}
+
+// addToManifest adds fixture, or replaces the one with the same name.
+func addToManifest(fixture Fixture) error {
+	fixtures, err := readManifest()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range fixtures {
+		if fixtures[i].Name == fixture.Name {
+			fixtures[i] = fixture
+			replaced = true
+		}
+	}
+	if !replaced {
+		fixtures = append(fixtures, fixture)
+	}
+	data, err := json.MarshalIndent(fixtures, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(*dir, MANIFEST), append(data, '\n'), 0644)
+}
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/yurutaso/termads"
-	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	MAXIMUM_RESULT int = 5
+	MAXIMUM_RESULT    int = 5
+	MAXIMUM_PAGE_SIZE int = 200
 )
 
 var (
 	t   = flag.String("t", "", "title of the paper")
-	n   = flag.Int("n", MAXIMUM_RESULT, "maximum number")
+	n   = flag.Int("n", MAXIMUM_RESULT, "maximum number (0 for all results)")
 	v   = flag.Bool("v", false, "verbose (show abstract of the paper)")
 	a   = flag.String("a", "", "author of the paper")
 	abs = flag.String("abs", "", "abstract of the paper")
@@ -24,6 +29,22 @@ var (
 	m1  = flag.Int("m1", 0, "month begin (ignored if -m is set)")
 	y2  = flag.Int("y2", 3000, "year end (ignored if -y is set)")
 	m2  = flag.Int("m2", 12, "month end (ignored if -m is set)")
+	tok = flag.String("token", termads.APIToken(), "ADS API token (use the v1 JSON API instead of the classic interface)")
+	bat = flag.Bool("batch", true, "fetch BibTeX of all papers in one request")
+	key = flag.String("key", "", "citation key pattern, e.g. %a%y for Author2019a (default: bibcode)")
+	f   = flag.String("format", termads.FORMAT_BIBTEX, "output format ("+strings.Join(termads.EXPORT_FORMATS, ", ")+")")
+	bib = flag.String("sync", "", "merge the BibTeX entries into this .bib file instead of printing them")
+
+	refresh    = flag.Bool("refresh", false, "ignore cached responses and fetch them again")
+	offline    = flag.Bool("offline", false, "use cached responses only")
+	nocache    = flag.Bool("nocache", false, "do not use the cache at all")
+	cachestats = flag.Bool("cachestats", false, "print cache statistics when done")
+
+	pdf        = flag.String("pdf", "", "download the PDFs of the papers into this directory instead of printing BibTeX")
+	pdfsources = flag.String("pdfsources", termads.DEFAULT_PDF_SOURCES, "link types to try for PDFs, in order of preference")
+
+	jobs    = flag.Int("j", termads.DEFAULT_FETCH_WORKERS, "number of concurrent requests for abstracts and BibTeX")
+	timeout = flag.Duration("timeout", 30*time.Second, "timeout of each request for an abstract or BibTeX entry")
 )
 
 func main() {
@@ -48,33 +69,246 @@ func main() {
 	form.Set(`aut_req`, `YES`)
 	form.Set(`txt_req`, `YES`)
 
+	// free-text query, e.g. author:"Kennicutt" year:1998-2005
+	if flag.NArg() > 0 {
+		query, err := termads.ParseQuery(strings.Join(flag.Args(), " "))
+		if err != nil {
+			if serr, ok := err.(*termads.QuerySyntaxError); ok {
+				fmt.Fprintln(os.Stderr, serr.Pointer())
+			}
+			fatal(err)
+		}
+		if *tok != "" {
+			form.SetAPIQuery(query)
+		} else if err := form.SetQuery(query); err != nil {
+			fatal(err)
+		}
+	}
+
 	// get links and bibcodes from doc
-	papers, err := termads.GetPapers(form)
+	client := termads.NewClient()
+	client.Token = *tok
+	if !*nocache {
+		client.Cache = termads.NewCache(termads.DefaultCacheDir())
+		client.Cache.Refresh = *refresh
+		client.Cache.Offline = *offline
+	}
+	if *cachestats && client.Cache != nil {
+		defer func() { fmt.Fprintf(os.Stderr, "cache %s: %s\n", client.Cache.Dir, client.Cache.Stats()) }()
+	}
+	// Ctrl-C aborts the requests in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results := client.SearchContext(ctx, form)
+	results.SetLimit(*n)
+	if *n > 0 && *n < MAXIMUM_PAGE_SIZE {
+		results.SetPageSize(*n)
+	}
+	papers, err := results.All()
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
-	count := 1
-	for _, paper := range papers {
-		if count > *n {
-			break
+	for _, warning := range results.Warnings() {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", warning)
+	}
+	if *pdf != "" {
+		downloadPDFs(ctx, client, papers)
+		return
+	}
+
+	if *f != termads.FORMAT_BIBTEX {
+		exporter, err := client.Exporter(*f)
+		if err != nil {
+			fatal(err)
 		}
-		count++
+		if *v {
+			fetched, _ := fetchDetails(ctx, client, papers, true, false)
+			for _, result := range fetched {
+				if result.AbstractErr != nil {
+					fmt.Fprintln(os.Stderr, result.AbstractErr)
+				}
+			}
+		}
+		out, err := exporter.ExportContext(ctx, papers)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(out)
+		return
+	}
+
+	// bibtex
+	fetched, _ := fetchDetails(ctx, client, papers, *v, !*bat)
+	entries := map[string]string{}
+	if *bat && len(papers) > 0 {
+		var missing []string
+		bibcodes := make([]string, len(papers))
+		for i, paper := range papers {
+			bibcodes[i] = paper.GetBibcode()
+		}
+		entries, missing, err = client.GetBibTexBatchContext(ctx, bibcodes)
+		if err != nil {
+			fatal(err)
+		}
+		for _, bibcode := range missing {
+			fmt.Fprintf(os.Stderr, "no BibTeX entry for %s\n", bibcode)
+		}
+	} else {
+		for _, result := range fetched {
+			if result.BibTexErr != nil {
+				fatal(result.BibTexErr)
+			}
+			entries[result.Paper.GetBibcode()] = result.BibTex
+		}
+	}
+	if *key != "" {
+		entries = rekey(papers, entries, *key)
+	}
+	if *bib != "" {
+		syncBibFile(*bib, papers, entries)
+		return
+	}
+
+	for i, paper := range papers {
 		// abstract
 		if *v {
-			err := paper.SetAbstractFromADS()
-			if err != nil {
+			if err := fetched[i].AbstractErr; err != nil {
 				fmt.Println(err)
 				continue
 			}
 			fmt.Println(paper.GetAbstract())
 		}
-		// bibtex
-		bibtex, err := paper.GetBibTex()
-		if err != nil {
-			log.Fatal(err)
+		bibtex, ok := entries[paper.GetBibcode()]
+		if !ok {
+			continue
 		}
 		fmt.Println(bibtex)
 		fmt.Println("--------------------------------------------")
 	}
+	// on stderr, so that the BibTeX can be redirected to a file
+	if total := results.Total(); total >= 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d papers shown.\n", results.Count(), total)
+	}
+	if quota := client.Quota(); quota.Known() && *v {
+		fmt.Fprintf(os.Stderr, "ADS quota: %s\n", quota)
+	}
 	return
 }
+
+// rekey replaces the citation keys of entries (keyed by bibcode) using
+// pattern, disambiguating equal keys in the order of papers.
+func rekey(papers []termads.Paper, entries map[string]string, pattern string) map[string]string {
+	file := termads.NewBibFile()
+	bibcodes := map[*termads.BibEntry]string{}
+	for _, paper := range papers {
+		parsed, err := termads.ParseBibTex(entries[paper.GetBibcode()])
+		if err != nil || len(parsed.Entries()) == 0 {
+			continue
+		}
+		entry := parsed.Entries()[0]
+		bibcodes[entry] = paper.GetBibcode()
+		file.Add(entry)
+	}
+	file.Rekey(pattern)
+	for entry, bibcode := range bibcodes {
+		entries[bibcode] = entry.String()
+	}
+	return entries
+}
+
+// syncBibFile merges entries into the .bib file at path and reports what
+// changed.
+func syncBibFile(path string, papers []termads.Paper, entries map[string]string) {
+	fetched := []*termads.BibEntry{}
+	for _, paper := range papers {
+		parsed, err := termads.ParseBibTex(entries[paper.GetBibcode()])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		fetched = append(fetched, parsed.Entries()...)
+	}
+	result, err := termads.SyncBibFile(path, fetched)
+	if err != nil {
+		fatal(err)
+	}
+	for _, key := range result.Added {
+		fmt.Printf("added    %s\n", key)
+	}
+	for _, key := range result.Updated {
+		fmt.Printf("updated  %s (refereed version)\n", key)
+	}
+	fmt.Printf("%d added, %d updated, %d already in %s.\n", len(result.Added), len(result.Updated), len(result.Unchanged), path)
+}
+
+// downloadPDFs saves the PDFs of papers into the -pdf directory and
+// reports where they are.
+func downloadPDFs(ctx context.Context, client *termads.Client, papers []termads.Paper) {
+	downloads, err := client.DownloadPDFs(ctx, papers, termads.DownloadOptions{
+		Dir:     *pdf,
+		Sources: *pdfsources,
+		Progress: func(paper termads.Paper, done, total int64) {
+			if total > 0 {
+				fmt.Fprintf(os.Stderr, "\r%s %3d%%", paper.GetBibcode(), 100*done/total)
+			}
+		},
+	})
+	for i, download := range downloads {
+		switch {
+		case download == nil:
+			fmt.Fprintf(os.Stderr, "\rno PDF   %s\n", papers[i].GetBibcode())
+		case download.Existed:
+			fmt.Printf("\rexists   %s\n", download.Path)
+		default:
+			fmt.Printf("\rsaved    %s (%s, %d kB)\n", download.Path, download.URL, download.Size/1024)
+		}
+	}
+	if err := savePDFPaths(downloads); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: the library keeps the old PDF paths: %v\n", err)
+	}
+	if derr, ok := err.(*termads.DownloadError); ok {
+		for _, paper := range papers {
+			if err, ok := derr.Failed[paper.GetBibcode()]; ok {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		os.Exit(termads.EXIT_NOT_FOUND)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// savePDFPaths records the downloaded PDFs of the papers that are in
+// the library.
+func savePDFPaths(downloads []*termads.Download) error {
+	library, err := termads.OpenLibrary(termads.DefaultLibraryPath())
+	if err != nil {
+		return err
+	}
+	if library.SetPDFs(downloads) == 0 {
+		return nil
+	}
+	return library.Save()
+}
+
+// fetchDetails fetches abstracts and/or BibTeX of papers concurrently.
+// Failures are reported in the results.
+func fetchDetails(ctx context.Context, client *termads.Client, papers []termads.Paper, abstract, bibtex bool) ([]*termads.FetchResult, error) {
+	return client.FetchDetails(ctx, papers, termads.FetchOptions{
+		Abstract: abstract,
+		BibTex:   bibtex,
+		Workers:  *jobs,
+		Timeout:  *timeout,
+	})
+}
+
+// fatal prints err with a hint on what to do and exits with the code
+// matching the error.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	if hint := termads.ErrorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, "hint: "+hint)
+	}
+	os.Exit(termads.ExitCode(err))
+}
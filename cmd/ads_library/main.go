@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/yurutaso/termads"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ads_library keeps papers in a local library (see termads.Library).
+
+	ads_library [flags] add BIBCODE...      add papers, with -tag and -pdf
+	ads_library [flags] list                list papers, with -tag and -unread
+	ads_library [flags] tag BIBCODE TAG...
+	ads_library [flags] untag BIBCODE TAG...
+	ads_library [flags] note BIBCODE TEXT...
+	ads_library [flags] read|unread BIBCODE...
+	ads_library [flags] remove BIBCODE...
+	ads_library [flags] export              print papers in -format
+	ads_library [flags] tags                list the tags in use
+	ads_library [flags] index               index abstracts and PDFs for search
+	ads_library [flags] search WORDS...     search the text of the papers, offline
+*/
+
+var (
+	lib    = flag.String("lib", termads.DefaultLibraryPath(), "library file")
+	tag    = flag.String("tag", "", "add: comma-separated tags to give; list, export: only papers with this tag")
+	unread = flag.Bool("unread", false, "list, export: only unread papers")
+	pdf    = flag.Bool("pdf", false, "add: download the PDFs too")
+	format = flag.String("format", termads.FORMAT_BIBTEX, "export: output format ("+strings.Join(termads.EXPORT_FORMATS, ", ")+")")
+	tok    = flag.String("token", termads.APIToken(), "ADS API token")
+	limit  = flag.Int("n", 10, "search: number of papers to show")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] add|list|tag|untag|note|read|unread|remove|export|tags|index|search [args]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(termads.EXIT_USAGE)
+	}
+	library, err := termads.OpenLibrary(*lib)
+	if err != nil {
+		fatal(err)
+	}
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	switch command {
+	case "add":
+		err = add(library, args)
+	case "list":
+		list(library)
+		return
+	case "tags":
+		for _, t := range library.Tags() {
+			fmt.Println(t)
+		}
+		return
+	case "export":
+		if err := export(library); err != nil {
+			fatal(err)
+		}
+		return
+	case "index", "search":
+		if command == "search" && len(args) == 0 {
+			flag.Usage()
+			os.Exit(termads.EXIT_USAGE)
+		}
+		if err := search(library, strings.Join(args, " ")); err != nil {
+			fatal(err)
+		}
+		return
+	case "tag", "untag", "note":
+		if len(args) < 2 {
+			flag.Usage()
+			os.Exit(termads.EXIT_USAGE)
+		}
+		var entry *termads.LibraryEntry
+		if entry, err = get(library, args[0]); err == nil {
+			switch command {
+			case "tag":
+				entry.Tag(args[1:]...)
+			case "untag":
+				entry.Untag(args[1:]...)
+			case "note":
+				entry.Notes = strings.Join(args[1:], " ")
+			}
+		}
+	case "read", "unread", "remove":
+		for _, bibcode := range args {
+			var entry *termads.LibraryEntry
+			if entry, err = get(library, bibcode); err != nil {
+				break
+			}
+			if command == "remove" {
+				library.Remove(entry.Bibcode)
+			} else {
+				entry.Read = command == "read"
+			}
+		}
+	default:
+		flag.Usage()
+		os.Exit(termads.EXIT_USAGE)
+	}
+	// keep what was done before an error
+	if serr := library.Save(); serr != nil {
+		fatal(serr)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func get(library *termads.Library, bibcode string) (*termads.LibraryEntry, error) {
+	entry := library.Get(bibcode)
+	if entry == nil {
+		return nil, fmt.Errorf("%s: %w in the library", bibcode, termads.ErrNotFound)
+	}
+	return entry, nil
+}
+
+// add fetches the papers and adds them. Papers already in the library
+// get their ADS data refreshed. It returns the last error.
+func add(library *termads.Library, bibcodes []string) (failed error) {
+	client := termads.NewClient()
+	client.Token = *tok
+	client.Cache = termads.NewCache(termads.DefaultCacheDir())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for _, bibcode := range bibcodes {
+		paper, err := client.GetPaperContext(ctx, bibcode)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = err
+			continue
+		}
+		// stored for the full-text search
+		if paper.GetAbstract() == "" {
+			if err := paper.SetAbstractFromADSContext(ctx); err != nil && ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		entry, added := library.Add(paper)
+		if *tag != "" {
+			entry.Tag(strings.Split(*tag, ",")...)
+		}
+		if *pdf {
+			download, err := client.DownloadPDF(ctx, paper, termads.DownloadOptions{})
+			if err == nil {
+				// the library is used from other directories too
+				if entry.PDF, err = filepath.Abs(download.Path); err != nil {
+					entry.PDF = download.Path
+				}
+			} else if ctx.Err() != nil {
+				return err
+			} else {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		if added {
+			fmt.Printf("added    %s %s\n", entry.Bibcode, entry.Title)
+		} else {
+			fmt.Printf("updated  %s %s\n", entry.Bibcode, entry.Title)
+		}
+	}
+	return failed
+}
+
+// list prints one line per paper; unread ones are marked with *.
+func list(library *termads.Library) {
+	for _, entry := range library.Select(*tag, *unread, nil) {
+		mark := " "
+		if !entry.Read {
+			mark = "*"
+		}
+		author := ""
+		if len(entry.Metadata.Authors) > 0 {
+			author = entry.Metadata.Authors[0].Last
+		}
+		line := fmt.Sprintf("%s %s %-15.15s %s", mark, entry.Bibcode, author, entry.Title)
+		if len(entry.Tags) > 0 {
+			line += " [" + strings.Join(entry.Tags, ", ") + "]"
+		}
+		fmt.Println(line)
+	}
+}
+
+// export prints the selected papers without going online.
+func export(library *termads.Library) error {
+	exporter, err := termads.LocalExporter(*format)
+	if err != nil {
+		return err
+	}
+	papers := termads.NewClient().LibraryPapers(library.Select(*tag, *unread, nil))
+	out, err := exporter.Export(papers)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+// search brings the index up to date and, unless query is empty, prints
+// the best papers with the matching words in bold on a terminal.
+func search(library *termads.Library, query string) error {
+	// next to the library, so that -lib gets its own index
+	index, err := termads.OpenIndex(filepath.Join(filepath.Dir(*lib), termads.INDEX_FILE))
+	if err != nil {
+		return err
+	}
+	indexed, err := index.Update(library)
+	if ierr, ok := err.(*termads.IndexError); ok {
+		for bibcode, err := range ierr.Failed {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", bibcode, err)
+		}
+	} else if err != nil {
+		return err
+	}
+	if indexed > 0 {
+		if err := index.Save(); err != nil {
+			return err
+		}
+	}
+	if query == "" {
+		fmt.Printf("%d papers indexed, %d in the index\n", indexed, len(index.Docs))
+		return nil
+	}
+	open, close := "*", "*"
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		open, close = "\x1b[1m", "\x1b[0m"
+	}
+	hits := index.Search(query, *limit)
+	if len(hits) == 0 {
+		return fmt.Errorf("%q: %w in the library", query, termads.ErrNotFound)
+	}
+	for _, hit := range hits {
+		title := ""
+		if entry := library.Get(hit.Bibcode); entry != nil {
+			title = termads.PlainText(entry.Title)
+		}
+		fmt.Printf("%s %5.2f %s\n", hit.Bibcode, hit.Score, title)
+		fmt.Printf("    %s\n", hit.Snippet.Mark(open, close))
+	}
+	return nil
+}
+
+// fatal prints err with a hint on what to do and exits with the code
+// matching the error.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+	if hint := termads.ErrorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, "hint: "+hint)
+	}
+	os.Exit(termads.ExitCode(err))
+}
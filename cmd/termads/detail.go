@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"github.com/yurutaso/termads"
+	"strings"
+	"time"
+)
+
+/*
+The detail pane replaces the results with everything known about the
+paper under the cursor. Its abstract is fetched from ADS the first time,
+in the background, with a spinner on the pane meanwhile.
+*/
+
+const spinnerFrames = `|/-\`
+
+// OpenDetail shows the paper under the cursor and starts fetching its
+// abstract if it has none yet.
+func (window *Window) OpenDetail() {
+	if len(window.papers) == 0 {
+		return
+	}
+	window.CloseDetail()
+	paper := window.papers[window.cursor]
+	window.detail = paper
+	window.detailOffset = 0
+	window.detailErr = nil
+	window.focus = focusDetail
+	window.status = "<j>/<k>, <PgDn>/<PgUp> to scroll, <q> to go back to the results."
+	if paper.GetAbstract() != "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	window.detailCancel = cancel
+	window.detailTask++
+	task := window.detailTask
+	post := func(f func()) {
+		window.updates <- func() {
+			// drop the results for a pane that was closed meanwhile
+			if task == window.detailTask {
+				f()
+			}
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				post(func() { window.spin++ })
+			}
+		}
+	}()
+	// the paper is read by the event loop meanwhile, so it is only set
+	// there, once the abstract is fetched
+	url := paper.GetURLOfType(termads.LINKTYPE_ABSTRACT)
+	missing := fmt.Errorf("abstract of %s: %w (no link)", paper.GetBibcode(), termads.ErrNotFound)
+	go func() {
+		abstract, err := "", missing
+		if url != "" {
+			abstract, err = window.client.GetAbstractContext(ctx, url)
+		}
+		close(done)
+		post(func() {
+			window.detailCancel = nil
+			window.detailErr = err
+			if err == nil {
+				paper.SetAbstract(abstract)
+			}
+		})
+	}()
+}
+
+// CloseDetail goes back to the results, stopping the abstract fetch.
+func (window *Window) CloseDetail() {
+	if window.detailCancel != nil {
+		window.detailCancel()
+		window.detailCancel = nil
+	}
+	window.detailTask++
+	window.detail = nil
+	if window.focus == focusDetail {
+		window.focus = focusResults
+		window.ScrollToCursor()
+	}
+}
+
+// ScrollDetail scrolls the pane by n lines.
+func (window *Window) ScrollDetail(n int) {
+	width, _ := termbox.Size()
+	last := len(window.detailLines(width)) - window.ResultHeight()
+	window.detailOffset += n
+	if window.detailOffset > last {
+		window.detailOffset = last
+	}
+	if window.detailOffset < 0 {
+		window.detailOffset = 0
+	}
+}
+
+// DrawDetail draws the pane over the results.
+func (window *Window) DrawDetail() {
+	width, _ := termbox.Size()
+	title := fit(" "+window.detail.GetBibcode()+"  <q> to go back", width)
+	drawText(0, resultYoff, title, termbox.ColorDefault|termbox.AttrReverse, termbox.ColorDefault)
+	lines := window.detailLines(width)
+	for i := 0; i < window.ResultHeight() && window.detailOffset+i < len(lines); i++ {
+		drawLine(0, resultYoff+1+i, lines[window.detailOffset+i])
+	}
+}
+
+// detailLines lays out the paper in lines of width.
+func (window *Window) detailLines(width int) []string {
+	paper := window.detail
+	meta := paper.Metadata()
+	lines := []string{}
+	section := func(name string) {
+		lines = append(lines, "", name)
+	}
+	add := func(text, indent string) {
+		lines = append(lines, wrap(text, width, indent)...)
+	}
+
+	add(paper.GetTitle(), "")
+	published := []string{}
+	if meta.Year > 0 {
+		date := fmt.Sprint(meta.Year)
+		if meta.Month > 0 {
+			date += fmt.Sprintf("/%02d", meta.Month)
+		}
+		published = append(published, date)
+	}
+	if meta.Bibstem != "" {
+		published = append(published, strings.TrimSpace(strings.Join([]string{meta.Bibstem, meta.Volume, meta.Page}, " ")))
+	}
+	if meta.DOI != "" {
+		published = append(published, "doi:"+meta.DOI)
+	}
+	if meta.ArXivID != "" {
+		published = append(published, "arXiv:"+meta.ArXivID)
+	}
+	if len(published) > 0 {
+		add(strings.Join(published, "  "), "")
+	}
+
+	// authors point to their affiliations by number
+	affiliations := meta.Affiliations()
+	number := map[string]int{}
+	for i, aff := range affiliations {
+		number[aff] = i + 1
+	}
+	authors := []string{}
+	for _, author := range paper.GetAuthorList() {
+		name := author.Name
+		if name == "" {
+			name = strings.TrimSpace(author.Last + ", " + author.First)
+		}
+		if n, ok := number[author.Affiliation]; ok {
+			name += fmt.Sprintf(" [%d]", n)
+		}
+		authors = append(authors, name)
+	}
+	if len(authors) > 0 {
+		section(fmt.Sprintf("Authors (%d)", len(authors)))
+		add(strings.Join(authors, "; "), "  ")
+	}
+	if len(affiliations) > 0 {
+		section("Affiliations")
+		for i, aff := range affiliations {
+			add(fmt.Sprintf("[%d] %s", i+1, aff), "      ")
+		}
+	}
+	if len(meta.Keywords) > 0 {
+		section("Keywords")
+		add(strings.Join(meta.Keywords, "; "), "  ")
+	}
+	if linktypes := paper.LinkTypes(); linktypes != "" {
+		section("Links")
+		for _, r := range linktypes {
+			linktype := string(r)
+			name, ok := termads.LINKTYPE_NAMES[linktype]
+			if !ok {
+				name = "Other"
+			}
+			add(fmt.Sprintf("%s  %s", linktype, name), "     ")
+		}
+	}
+
+	section("Abstract")
+	switch {
+	case paper.GetAbstract() != "":
+		for _, paragraph := range strings.Split(termads.PlainText(paper.GetAbstract()), "\n") {
+			add(paragraph, "  ")
+		}
+	case window.detailCancel != nil:
+		frame := window.spin % len(spinnerFrames)
+		lines = append(lines, "  Fetching the abstract from ADS... "+spinnerFrames[frame:frame+1])
+	case window.detailErr != nil:
+		add("Error: "+window.detailErr.Error(), "  ")
+	}
+	return lines
+}
+
+// wrap breaks text at spaces into lines of at most width columns, each
+// starting with indent. Words longer than a line are cut.
+func wrap(text string, width int, indent string) []string {
+	lines := []string{}
+	line := indent
+	empty := true
+	for _, word := range strings.Fields(text) {
+		n := len([]rune(line)) + len([]rune(word))
+		if !empty {
+			n++
+		}
+		if n > width && !empty {
+			lines = append(lines, line)
+			line, empty = indent, true
+		}
+		for rest := width - len([]rune(indent)); rest > 0 && len([]rune(word)) > rest; {
+			runes := []rune(word)
+			lines = append(lines, indent+string(runes[:rest]))
+			word = string(runes[rest:])
+		}
+		if !empty {
+			line += " "
+		}
+		line += word
+		empty = false
+	}
+	if !empty {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (window *Window) HandleKeyEventInDetail(ev termbox.Event) int {
+	switch ev.Key {
+	case termbox.KeyArrowDown, termbox.KeyCtrlN, termbox.KeyEnter:
+		window.ScrollDetail(1)
+	case termbox.KeyArrowUp, termbox.KeyCtrlP:
+		window.ScrollDetail(-1)
+	case termbox.KeySpace:
+		window.ScrollDetail(window.ResultHeight())
+	case termbox.KeyArrowLeft, termbox.KeyBackspace, termbox.KeyBackspace2:
+		window.CloseDetail()
+	default:
+		switch ev.Ch {
+		case 'j':
+			window.ScrollDetail(1)
+		case 'k':
+			window.ScrollDetail(-1)
+		case 'g':
+			window.ScrollDetail(-window.detailOffset)
+		case 'G':
+			width, _ := termbox.Size()
+			window.ScrollDetail(len(window.detailLines(width)))
+		case 'q', 'h':
+			window.CloseDetail()
+		}
+	}
+	return statusContinue
+}
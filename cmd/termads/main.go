@@ -1,25 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/nsf/termbox-go"
 	"github.com/yurutaso/termads"
+	"io/ioutil"
 	"log"
+	"strings"
+	"time"
 )
 
-/*
-TODO:
-	1. Page the search result
-	2. Select the result
-	3. Download PDF file of the selected result
-	4. Status bar (window), which shows download status etc.
-*/
-
 const (
 	statusExit     = -1
 	statusContinue = 1
+	resultYoff     = 11
+	exportFile     = "termads-export"
+	fetchTimeout   = 30 * time.Second
 )
 
+var exportExtensions = map[string]string{
+	termads.FORMAT_BIBTEX:   ".bib",
+	termads.FORMAT_RIS:      ".ris",
+	termads.FORMAT_ENDNOTE:  ".enw",
+	termads.FORMAT_AASTEX:   ".tex",
+	termads.FORMAT_CSL_JSON: ".json",
+}
+
 type Panel struct {
 	x                 int
 	y                 int
@@ -141,14 +148,41 @@ func (panel *Panel) MoveCursorRight() {
 
 /* Window */
 type Window struct {
-	panels []*Panel
-	papers []*termads.Paper
-	data   map[string]string
-	active int
+	panels  []*Panel
+	papers  []termads.Paper
+	results *termads.ResultIterator
+	offset  int
+	data    map[string]string
+	active  int
+	status  string
+	client  *termads.Client
+	format  int
+	entries []*termads.LibraryEntry // of the papers when the library is shown
+	hits    []termads.SearchHit     // of the papers when the library was searched
+
+	focus    int             // focusForm or focusResults
+	cursor   int             // index in papers of the highlighted result
+	selected map[string]bool // bibcodes of the selected papers
+
+	detail       termads.Paper      // shown in the detail pane, nil if it is closed
+	detailOffset int                // first line of the pane shown
+	detailErr    error              // of fetching the abstract
+	detailCancel context.CancelFunc // stops fetching the abstract, nil if done
+	detailTask   int                // id of the latest abstract fetch
+	spin         int                // frame of the spinner
+
+	search     context.Context    // context of the current search
+	stopSearch context.CancelFunc // cancels it
+	cancel     context.CancelFunc // cancels the background task, nil if none runs
+	task       int                // id of the latest background task
+	updates    chan func()        // results of background tasks for the event loop
 }
 
 func NewWindow(panels []*Panel) *Window {
-	return &Window{panels: panels, data: map[string]string{}}
+	client := termads.NewClient()
+	client.Token = termads.APIToken()
+	client.Cache = termads.NewCache(termads.DefaultCacheDir())
+	return &Window{panels: panels, data: map[string]string{}, client: client, updates: make(chan func()), selected: map[string]bool{}}
 }
 
 func (window *Window) ActivePanel() *Panel {
@@ -160,10 +194,21 @@ func (window *Window) RedrawAll() {
 	for _, panel := range window.panels {
 		panel.DrawText()
 	}
-	window.ActivePanel().DrawCursor()
-	yoff := 10
-	for i, paper := range window.papers {
-		drawLine(0, yoff+i, paper.GetBibcode()+" "+paper.AvailableLinkTypes()+" "+paper.GetTitle())
+	if window.focus == focusForm {
+		window.ActivePanel().DrawCursor()
+	} else {
+		termbox.HideCursor()
+	}
+	if window.detail != nil {
+		window.DrawDetail()
+	} else {
+		window.DrawResults()
+	}
+	width, height := termbox.Size()
+	drawLine(0, height-1, window.status)
+	if quota := window.client.Quota(); quota.Known() {
+		q := fmt.Sprintf(" ADS quota %d/%d", quota.Remaining, quota.Limit)
+		drawLine(width-len(q), height-1, q)
 	}
 	termbox.Flush()
 }
@@ -227,14 +272,494 @@ func (window *Window) GetPapersFromADS() error {
 	for key, val := range window.data {
 		form.Set(key, val)
 	}
-	papers, err := termads.GetLinks(form)
-	window.papers = papers
+	if text := window.data["query"]; text != "" {
+		query, err := termads.ParseQuery(text)
+		if err != nil {
+			return err
+		}
+		if window.client.Token != "" {
+			form.SetAPIQuery(query)
+		} else if err := form.SetQuery(query); err != nil {
+			return err
+		}
+	}
+	// a new search stops paging through the previous one
+	if window.stopSearch != nil {
+		window.stopSearch()
+	}
+	window.search, window.stopSearch = context.WithCancel(context.Background())
+	window.results = window.client.SearchContext(window.search, form)
+	window.results.SetPageSize(window.ResultHeight())
+	window.papers = nil
+	window.entries = nil
+	window.hits = nil
+	window.resetResults()
+	window.LoadPage(0, 0)
+	return nil
+}
+
+// resetResults moves to the top of a new list of papers, with nothing
+// selected.
+func (window *Window) resetResults() {
+	window.CloseDetail()
+	window.offset = 0
+	window.cursor = 0
+	window.selected = map[string]bool{}
+	window.focus = focusResults
+}
+
+// ResultHeight is the number of result lines that fit on the screen,
+// below the header and above the status bar.
+func (window *Window) ResultHeight() int {
+	_, height := termbox.Size()
+	if height-resultYoff-2 < 1 {
+		return 1
+	}
+	return height - resultYoff - 2
+}
+
+// LoadPage shows the page starting at offset, first fetching its papers
+// in the background if they are not loaded yet. <Esc> cancels the search.
+// The cursor moves to cursor once the papers are there, or to the
+// nearest one loaded; until then it stays where it is.
+func (window *Window) LoadPage(offset, cursor int) {
+	need := offset + window.ResultHeight() - len(window.papers)
+	if need <= 0 || window.results == nil {
+		window.offset = offset
+		window.cursor = cursor
+		window.UpdatePageStatus()
+		return
+	}
+	results := window.results
+	window.Background(window.search, window.stopSearch, "Searching ADS...", func(_ context.Context, progress func(string)) func() error {
+		papers := []termads.Paper{}
+		var err error
+		for len(papers) < need {
+			var page []termads.Paper
+			if page, err = results.NextPage(); err != nil || page == nil {
+				break
+			}
+			papers = append(papers, page...)
+			progress(fmt.Sprintf("Searching ADS... %d papers.", len(papers)))
+		}
+		return func() error {
+			window.papers = append(window.papers, papers...)
+			if offset < len(window.papers) {
+				window.offset = offset
+			}
+			window.cursor = cursor
+			window.UpdatePageStatus()
+			return err
+		}
+	})
+}
+
+func (window *Window) UpdatePageStatus() {
+	if len(window.papers) == 0 {
+		window.status = "No papers found."
+		return
+	}
+	window.clampCursor()
+	end := window.offset + window.ResultHeight()
+	if end > len(window.papers) {
+		end = len(window.papers)
+	}
+	selected := ""
+	if n := len(window.selected); n > 0 {
+		selected = fmt.Sprintf(" %d selected.", n)
+	}
+	switch {
+	case window.hits != nil:
+		window.status = fmt.Sprintf("Library search: papers %d-%d of %d.%s <F6> to show the whole library.", window.offset+1, end, len(window.papers), selected)
+	case window.entries != nil:
+		window.status = fmt.Sprintf("Library: papers %d-%d of %d.%s <F8> searches their text for the Query words.", window.offset+1, end, len(window.papers), selected)
+	default:
+		total := "?"
+		if n := window.results.Total(); n >= 0 {
+			total = fmt.Sprint(n)
+		}
+		window.status = fmt.Sprintf("Papers %d-%d of %s.%s <Space> to select, <F5> to download PDFs, <F7> to keep in the library.", window.offset+1, end, total, selected)
+		if n := len(window.results.Warnings()); n > 0 {
+			window.status += fmt.Sprintf(" %d records could not be read fully.", n)
+		}
+	}
+}
+
+func (window *Window) NextPage() {
+	if window.Busy() {
+		return
+	}
+	if window.entries != nil {
+		if window.offset+window.ResultHeight() < len(window.papers) {
+			window.offset += window.ResultHeight()
+		}
+		window.UpdatePageStatus()
+		return
+	}
+	if window.results != nil {
+		window.LoadPage(window.offset+window.ResultHeight(), window.cursor)
+	}
+}
+
+func (window *Window) PrevPage() {
+	if window.Busy() {
+		return
+	}
+	window.offset -= window.ResultHeight()
+	if window.offset < 0 {
+		window.offset = 0
+	}
+	if window.results != nil || window.entries != nil {
+		window.UpdatePageStatus()
+	}
+}
+
+// NextFormat cycles through termads.EXPORT_FORMATS.
+func (window *Window) NextFormat() {
+	window.format = (window.format + 1) % len(termads.EXPORT_FORMATS)
+	window.status = "Export format: " + termads.EXPORT_FORMATS[window.format] + ". <F3> to export the results, <F4> to fetch abstracts first."
+}
+
+// ExportResults writes the selected papers, or all loaded papers, to termads-export.<ext>.
+func (window *Window) ExportResults() error {
+	if len(window.papers) == 0 {
+		window.status = "No papers to export."
+		return nil
+	}
+	if window.Busy() {
+		return nil
+	}
+	format := termads.EXPORT_FORMATS[window.format]
+	exporter, err := window.client.Exporter(format)
+	if err != nil {
+		return err
+	}
+	ext, ok := exportExtensions[format]
+	if !ok {
+		ext = ".txt"
+	}
+	papers := window.papers
+	if selected := window.SelectedPapers(); selected != nil {
+		papers = selected
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	window.Background(ctx, cancel, "Exporting...", func(ctx context.Context, _ func(string)) func() error {
+		out, err := exporter.ExportContext(ctx, papers)
+		if err == nil {
+			err = ioutil.WriteFile(exportFile+ext, []byte(out+"\n"), 0644)
+		}
+		return func() error {
+			if err != nil {
+				return err
+			}
+			window.status = fmt.Sprintf("Exported %d papers to %s.", len(papers), exportFile+ext)
+			return nil
+		}
+	})
+	return nil
+}
+
+// FetchAbstracts downloads the abstracts of the selected or loaded papers, e.g.
+// before exporting them to RIS, showing the progress in the status bar.
+func (window *Window) FetchAbstracts() error {
+	if len(window.papers) == 0 {
+		window.status = "No papers loaded."
+		return nil
+	}
+	if window.Busy() {
+		return nil
+	}
+	papers := window.papers
+	if selected := window.SelectedPapers(); selected != nil {
+		papers = selected
+	}
+	// the workers fill in copies; the papers shown are only changed here,
+	// on the event loop, when the abstracts are there
+	copies := make([]termads.Paper, len(papers))
+	for i, paper := range papers {
+		copies[i] = window.client.NewPaper()
+		copies[i].SetBibcode(paper.GetBibcode())
+		copies[i].SetAbstract(paper.GetAbstract())
+		for _, linktype := range paper.LinkTypes() {
+			if err := copies[i].SetURL(paper.GetURLOfType(string(linktype)), string(linktype)); err != nil {
+				return err
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	window.Background(ctx, cancel, "Fetching abstracts...", func(ctx context.Context, progress func(string)) func() error {
+		_, err := window.client.FetchDetails(ctx, copies, termads.FetchOptions{
+			Abstract: true,
+			Timeout:  fetchTimeout,
+			Progress: func(done, total int, _ *termads.FetchResult) {
+				progress(fmt.Sprintf("Fetching abstracts... %d/%d", done, total))
+			},
+		})
+		return func() error {
+			for i, paper := range papers {
+				if abstract := copies[i].GetAbstract(); abstract != "" {
+					paper.SetAbstract(abstract)
+				}
+			}
+			window.status = fmt.Sprintf("Fetched abstracts of %d papers.", len(papers))
+			return err
+		}
+	})
+	return nil
+}
+
+// DownloadPDFs saves the PDFs of the selected papers, or else of those
+// on the screen, to
+// termads.DefaultPDFDir(), showing the progress in the status bar.
+func (window *Window) DownloadPDFs() error {
+	if len(window.papers) == 0 {
+		window.status = "No papers loaded."
+		return nil
+	}
+	if window.Busy() {
+		return nil
+	}
+	papers := window.PapersOnScreen()
+	dir := termads.DefaultPDFDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	window.Background(ctx, cancel, "Downloading PDFs...", func(ctx context.Context, progress func(string)) func() error {
+		index := map[string]int{}
+		for i, paper := range papers {
+			index[paper.GetBibcode()] = i + 1
+		}
+		last := ""
+		downloads, err := window.client.DownloadPDFs(ctx, papers, termads.DownloadOptions{
+			Dir: dir,
+			Progress: func(paper termads.Paper, done, total int64) {
+				s := fmt.Sprintf("Downloading PDF %d/%d %s... %d kB", index[paper.GetBibcode()], len(papers), paper.GetBibcode(), done/1024)
+				if total > 0 {
+					s = fmt.Sprintf("Downloading PDF %d/%d %s... %d%%", index[paper.GetBibcode()], len(papers), paper.GetBibcode(), 100*done/total)
+				}
+				// only when the status changes, not for every read
+				if s != last {
+					last = s
+					progress(s)
+				}
+			},
+		})
+		// the library keeps where its PDFs are, for the full-text search
+		library, lerr := termads.OpenLibrary(termads.DefaultLibraryPath())
+		if lerr == nil && library.SetPDFs(downloads) > 0 {
+			lerr = library.Save()
+		}
+		return func() error {
+			n := 0
+			for _, download := range downloads {
+				if download != nil {
+					n++
+				}
+			}
+			window.status = fmt.Sprintf("%d of %d PDFs in %s.", n, len(papers), dir)
+			if lerr == nil {
+				// the entries shown are the library's as it was read
+				for _, entry := range window.entries {
+					if entry == nil {
+						continue
+					}
+					if saved := library.Get(entry.Bibcode); saved != nil {
+						entry.PDF = saved.PDF
+					}
+				}
+			}
+			// papers without a PDF are counted above
+			if _, ok := err.(*termads.DownloadError); ok {
+				err = nil
+			}
+			if err == nil {
+				err = lerr
+			}
+			return err
+		}
+	})
+	return nil
+}
+
+// ShowLibrary lists the papers of the local library in place of the
+// search results. It works offline.
+func (window *Window) ShowLibrary() error {
+	if window.Busy() {
+		return nil
+	}
+	library, err := termads.OpenLibrary(termads.DefaultLibraryPath())
 	if err != nil {
 		return err
 	}
+	if window.stopSearch != nil {
+		window.stopSearch()
+	}
+	window.results = nil
+	window.hits = nil
+	window.entries = library.Entries
+	window.papers = window.client.LibraryPapers(library.Entries)
+	window.resetResults()
+	if len(window.papers) == 0 {
+		window.status = "The library is empty. <F7> on search results adds them."
+		return nil
+	}
+	window.UpdatePageStatus()
 	return nil
 }
 
+// SearchLibrary searches the text of the library papers for the words in
+// the query box, offline, and shows them best first with the matches
+// highlighted. Papers new to the index are indexed in the background.
+func (window *Window) SearchLibrary() error {
+	if window.Busy() {
+		return nil
+	}
+	window.GetForms()
+	query := window.data["query"]
+	if strings.TrimSpace(query) == "" {
+		window.status = "Type the words to search the library for in the Query box, then <F8>."
+		return nil
+	}
+	library, err := termads.OpenLibrary(termads.DefaultLibraryPath())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	window.Background(ctx, cancel, "Indexing the library...", func(ctx context.Context, progress func(string)) func() error {
+		index, err := termads.OpenIndex(termads.DefaultIndexPath())
+		if err != nil {
+			return func() error { return err }
+		}
+		indexed, err := index.Update(library)
+		if _, ok := err.(*termads.IndexError); ok {
+			// those papers are still found by title and abstract
+			err = nil
+		}
+		if err == nil && indexed > 0 {
+			err = index.Save()
+		}
+		if err != nil {
+			return func() error { return err }
+		}
+		hits := index.Search(query, 0)
+		return func() error {
+			if window.stopSearch != nil {
+				window.stopSearch()
+			}
+			window.results = nil
+			window.hits = hits
+			window.entries = make([]*termads.LibraryEntry, len(hits))
+			for i, hit := range hits {
+				window.entries[i] = library.Get(hit.Bibcode)
+			}
+			window.papers = window.client.LibraryPapers(window.entries)
+			window.resetResults()
+			if len(hits) == 0 {
+				window.status = fmt.Sprintf("No papers of the library match %q.", query)
+				return nil
+			}
+			window.UpdatePageStatus()
+			return nil
+		}
+	})
+	return nil
+}
+
+// AddToLibrary stores the selected papers, or else those on the screen,
+// in the library.
+func (window *Window) AddToLibrary() error {
+	if window.Busy() {
+		return nil
+	}
+	if window.entries != nil || len(window.papers) == 0 {
+		window.status = "No search results to add."
+		return nil
+	}
+	library, err := termads.OpenLibrary(termads.DefaultLibraryPath())
+	if err != nil {
+		return err
+	}
+	papers := window.PapersOnScreen()
+	added := 0
+	for _, paper := range papers {
+		if _, ok := library.Add(paper); ok {
+			added++
+		}
+	}
+	if err := library.Save(); err != nil {
+		return err
+	}
+	window.status = fmt.Sprintf("%d papers added to the library, %d updated. <F6> to show it.", added, len(papers)-added)
+	return nil
+}
+
+// Background runs work in a goroutine so that the screen stays responsive
+// and <Esc> can cancel it through cancel. work must not touch the window:
+// the function it returns is run by the event loop to apply the result,
+// and progress updates the status bar.
+func (window *Window) Background(ctx context.Context, cancel context.CancelFunc, status string, work func(ctx context.Context, progress func(string)) func() error) {
+	window.Cancel()
+	window.task++
+	task := window.task
+	window.cancel = cancel
+	window.status = status + " <Esc> to cancel."
+	post := func(f func()) {
+		window.updates <- func() {
+			// drop results of cancelled or superseded tasks
+			if task == window.task {
+				f()
+			}
+		}
+	}
+	go func() {
+		apply := work(ctx, func(s string) {
+			post(func() { window.status = s + " <Esc> to cancel." })
+		})
+		post(func() {
+			window.cancel = nil
+			if err := apply(); err != nil {
+				window.ShowError(err)
+			}
+		})
+	}()
+}
+
+// Busy reports whether a background task is running.
+func (window *Window) Busy() bool {
+	if window.cancel != nil {
+		window.status = "Busy. <Esc> to cancel."
+		return true
+	}
+	return false
+}
+
+// Cancel stops the background task and reports whether one was running.
+func (window *Window) Cancel() bool {
+	if window.cancel == nil {
+		return false
+	}
+	window.cancel()
+	window.cancel = nil
+	window.task++
+	window.status = "Cancelled."
+	return true
+}
+
+// ShowError writes err to the status bar. Syntax errors in the query box
+// move the cursor to the offending column.
+func (window *Window) ShowError(err error) {
+	window.status = "Error: " + err.Error()
+	serr, ok := err.(*termads.QuerySyntaxError)
+	if !ok {
+		return
+	}
+	for i, panel := range window.panels {
+		if panel.name == "query" {
+			window.active = i
+			panel.cursor.Set(panel.x+serr.Column-1, panel.y)
+			return
+		}
+	}
+}
+
 func (window *Window) FormIsEmpty() bool {
 	for _, val := range window.data {
 		if len(val) > 0 {
@@ -247,128 +772,165 @@ func (window *Window) FormIsEmpty() bool {
 func pollEvent() {
 	panels := []*Panel{
 		NewPanel(0, 0, "Input seach forms, then press <Enter> to get links from ADS."),
-		NewPanel(0, 1, "Press <TAB>/<Ctrl-N> or <Ctrl-P> to move between forms."),
+		NewPanel(0, 1, "Press <TAB>/<Ctrl-N> or <Ctrl-P> to move between forms, <Ctrl-W> to go to the results."),
 		NewPanel(0, 2, "------------------------------------------------------------"),
 		// Row 1
-		NewPanel(0, 3, "   Authors:"),
-		NewPanelForm(12, 3, 100, "", "author"),
+		NewPanel(0, 3, "     Query:"),
+		NewPanelForm(12, 3, 100, "", "query"),
 		// Row 2
-		NewPanel(0, 4, "start year:"),
-		NewPanelForm(12, 4, 4, "", "start_year"),
-		NewPanel(18, 4, "month:"),
-		NewPanelForm(25, 4, 2, "", "end_mon"),
+		NewPanel(0, 4, "   Authors:"),
+		NewPanelForm(12, 4, 100, "", "author"),
 		// Row 3
-		NewPanel(0, 5, "  end year:"),
-		NewPanelForm(12, 5, 4, "", "end_year"),
+		NewPanel(0, 5, "start year:"),
+		NewPanelForm(12, 5, 4, "", "start_year"),
 		NewPanel(18, 5, "month:"),
-		NewPanelForm(25, 5, 2, "", "end_mon"),
+		NewPanelForm(25, 5, 2, "", "start_mon"),
 		// Row 4
-		NewPanel(0, 6, "     Title:"),
-		NewPanelForm(12, 6, 100, "", "title"),
+		NewPanel(0, 6, "  end year:"),
+		NewPanelForm(12, 6, 4, "", "end_year"),
+		NewPanel(18, 6, "month:"),
+		NewPanelForm(25, 6, 2, "", "end_mon"),
 		// Row 5
-		NewPanel(0, 7, "  Abstract:"),
-		NewPanelForm(12, 7, 100, "", "text"),
+		NewPanel(0, 7, "     Title:"),
+		NewPanelForm(12, 7, 100, "", "title"),
 		// Row 6
-		NewPanel(0, 8, "------------------------------------------------------------"),
+		NewPanel(0, 8, "  Abstract:"),
+		NewPanelForm(12, 8, 100, "", "text"),
+		// Row 7
+		NewPanel(0, 9, "------------------------------------------------------------"),
 	}
 
 	window := NewWindow(panels)
 	window.FocusNextForm()
 	window.RedrawAll()
+	events := make(chan termbox.Event)
+	go func() {
+		for {
+			events <- termbox.PollEvent()
+		}
+	}()
 	for {
-		status := window.HandleKeyEventInForm(termbox.PollEvent())
-		if status == statusExit {
-			return
+		select {
+		case ev := <-events:
+			if window.HandleKeyEvent(ev) == statusExit {
+				window.Cancel()
+				return
+			}
+		case apply := <-window.updates:
+			apply()
 		}
 		window.RedrawAll()
 	}
 }
 
-/*
-func (window *Window) HandleKeyEventInResult(ev termbox.Event) int {
+// HandleKeyEvent handles the keys that work everywhere and passes the
+// others to the forms or the results, whichever has the focus.
+func (window *Window) HandleKeyEvent(ev termbox.Event) int {
 	switch ev.Type {
+	case termbox.EventResize:
+		window.ScrollToCursor()
 	case termbox.EventKey:
 		switch ev.Key {
-		// Terminate
+		// Terminate, or cancel the running search, or close the details
+		case termbox.KeyEsc:
+			switch {
+			case window.Cancel():
+			case window.focus == focusDetail:
+				window.CloseDetail()
+			default:
+				return statusExit
+			}
 		case termbox.KeyCtrlC:
 			return statusExit
-		// Send forms to ADS
-		case termbox.KeyEnter:
-			return statusExit
-		// Motions
-		case termbox.KeyArrowDown:
-			window.NextResult()
-		case termbox.KeyArrowUp:
-			window.PrevResult()
-		case termbox.KeyArrowRight:
-			window.MoveCursorRight()
-		case termbox.KeyArrowLeft:
-			window.MoveCursorLeft()
-		case termbox.KeySpace:
-			window.SelectResult()
+		case termbox.KeyCtrlW:
+			window.ToggleFocus()
+		// Paging
+		case termbox.KeyPgdn:
+			if window.focus == focusDetail {
+				window.ScrollDetail(window.ResultHeight())
+			} else {
+				window.NextPage()
+			}
+		case termbox.KeyPgup:
+			if window.focus == focusDetail {
+				window.ScrollDetail(-window.ResultHeight())
+			} else {
+				window.PrevPage()
+			}
+		// Export
+		case termbox.KeyF2:
+			window.NextFormat()
+		case termbox.KeyF3:
+			if err := window.ExportResults(); err != nil {
+				window.ShowError(err)
+			}
+		case termbox.KeyF4:
+			if err := window.FetchAbstracts(); err != nil {
+				window.ShowError(err)
+			}
+		case termbox.KeyF5:
+			if err := window.DownloadPDFs(); err != nil {
+				window.ShowError(err)
+			}
+		// Library
+		case termbox.KeyF6:
+			if err := window.ShowLibrary(); err != nil {
+				window.ShowError(err)
+			}
+		case termbox.KeyF7:
+			if err := window.AddToLibrary(); err != nil {
+				window.ShowError(err)
+			}
+		case termbox.KeyF8:
+			if err := window.SearchLibrary(); err != nil {
+				window.ShowError(err)
+			}
 		default:
-			if ev.Ch != 0 {
-				s = string(ev.Ch)
-				switch s {
-				case 'h':
-					window.MoveCursorLeft()
-				case 'j':
-					window.NextResult()
-				case 'k':
-					window.PrevResult()
-				case 'l':
-					window.MoveCursorRight()
-				case 'g':
-					window.FirstResult()
-				case 'G':
-					window.LastResult()
-				}
+			switch window.focus {
+			case focusResults:
+				return window.HandleKeyEventInResult(ev)
+			case focusDetail:
+				return window.HandleKeyEventInDetail(ev)
 			}
+			return window.HandleKeyEventInForm(ev)
 		}
 	}
 	return statusContinue
 }
-*/
 
 func (window *Window) HandleKeyEventInForm(ev termbox.Event) int {
-	switch ev.Type {
-	case termbox.EventKey:
-		switch ev.Key {
-		// Terminate
-		case termbox.KeyEsc, termbox.KeyCtrlC:
-			return statusExit
-		// Send forms to ADS
-		case termbox.KeyEnter:
-			window.GetForms()
-			err := window.GetPapersFromADS()
-			if err != nil {
-				return statusExit
-			}
-		// Motions
-		case termbox.KeyTab, termbox.KeyCtrlN, termbox.KeyArrowDown:
-			window.FocusNextForm()
-		case termbox.KeyCtrlP, termbox.KeyArrowUp:
-			window.FocusPrevForm()
-		case termbox.KeyCtrlF, termbox.KeyArrowRight:
-			window.ActivePanel().MoveCursorRight()
-		case termbox.KeyCtrlB, termbox.KeyArrowLeft:
-			window.ActivePanel().MoveCursorLeft()
-		case termbox.KeyCtrlE:
-			window.ActivePanel().MoveCursorLast()
-		case termbox.KeyCtrlA:
-			window.ActivePanel().MoveCursorFirst()
-		// Edit text
-		case termbox.KeyBackspace, termbox.KeyBackspace2:
-			window.ActivePanel().Backspace()
-		case termbox.KeySpace:
-			window.ActivePanel().InsertText(" ")
-		case termbox.KeyCtrlU:
-			window.ActivePanel().RemoveText()
-		default:
-			if ev.Ch != 0 {
-				s := string(ev.Ch)
-				window.ActivePanel().InsertText(s)
-			}
+	switch ev.Key {
+	// Send forms to ADS
+	case termbox.KeyEnter:
+		window.GetForms()
+		err := window.GetPapersFromADS()
+		if err != nil {
+			window.ShowError(err)
+		}
+	// Motions
+	case termbox.KeyTab, termbox.KeyCtrlN, termbox.KeyArrowDown:
+		window.FocusNextForm()
+	case termbox.KeyCtrlP, termbox.KeyArrowUp:
+		window.FocusPrevForm()
+	case termbox.KeyCtrlF, termbox.KeyArrowRight:
+		window.ActivePanel().MoveCursorRight()
+	case termbox.KeyCtrlB, termbox.KeyArrowLeft:
+		window.ActivePanel().MoveCursorLeft()
+	case termbox.KeyCtrlE:
+		window.ActivePanel().MoveCursorLast()
+	case termbox.KeyCtrlA:
+		window.ActivePanel().MoveCursorFirst()
+	// Edit text
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		window.ActivePanel().Backspace()
+	case termbox.KeySpace:
+		window.ActivePanel().InsertText(" ")
+	case termbox.KeyCtrlU:
+		window.ActivePanel().RemoveText()
+	default:
+		if ev.Ch != 0 {
+			s := string(ev.Ch)
+			window.ActivePanel().InsertText(s)
 		}
 	}
 	return statusContinue
@@ -383,11 +945,31 @@ func main() {
 	pollEvent()
 }
 
-func drawLine(x, y int, str string) {
-	color := termbox.ColorDefault
-	bgrcolor := termbox.ColorDefault
+// drawLine returns the column after the text.
+func drawLine(x, y int, str string) int {
+	return drawText(x, y, str, termbox.ColorDefault, termbox.ColorDefault)
+}
+
+func drawText(x, y int, str string, color, bgrcolor termbox.Attribute) int {
 	runes := []rune(str)
 	for i := 0; i < len(runes); i++ {
 		termbox.SetCell(x+i, y, runes[i], color, bgrcolor)
 	}
+	return x + len(runes)
+}
+
+// drawMatches draws a snippet with its matches in bold yellow.
+func drawMatches(x, y int, snippet termads.Snippet, color, bgrcolor termbox.Attribute) {
+	m := 0
+	for i, r := range snippet.Text {
+		for m < len(snippet.Matches) && snippet.Matches[m][1] <= i {
+			m++
+		}
+		fg := color
+		if m < len(snippet.Matches) && snippet.Matches[m][0] <= i {
+			fg = termbox.ColorYellow | termbox.AttrBold | color&termbox.AttrReverse
+		}
+		termbox.SetCell(x, y, r, fg, bgrcolor)
+		x++
+	}
 }
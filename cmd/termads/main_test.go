@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/yurutaso/termads"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWindow returns a window without a screen showing papers.
+func testWindow(papers ...termads.Paper) *Window {
+	client := termads.NewClient()
+	client.Limiter = nil
+	client.Retry = nil
+	return &Window{data: map[string]string{}, client: client, updates: make(chan func()), selected: map[string]bool{}, papers: papers}
+}
+
+// wait runs the updates of the background task on the test's goroutine,
+// as the event loop does, until the task is done.
+func wait(t *testing.T, window *Window) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for window.cancel != nil {
+		select {
+		case update := <-window.updates:
+			update()
+		case <-timeout:
+			t.Fatal(`the background task did not finish`)
+		}
+	}
+}
+
+func TestFetchAbstracts(t *testing.T) {
+	page, err := ioutil.ReadFile(filepath.Join(`..`, `..`, `testdata`, `abstract_1998ApJ_498_541K.html`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, `/1998ApJ...498..541K`) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(`Content-Type`, `text/html`)
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	paper := func(bibcode, abstract string) termads.Paper {
+		p := termads.NewPaper()
+		p.SetBibcode(bibcode)
+		p.SetAbstract(abstract)
+		p.SetURL(server.URL+`/abs/`+bibcode, termads.LINKTYPE_ABSTRACT)
+		p.SetURL(server.URL+`/pdf/`+bibcode, termads.LINKTYPE_FULL_ARTICLE)
+		return p
+	}
+	fetched := paper(`1998ApJ...498..541K`, ``)
+	missing := paper(`2001ApJ...100..100B`, ``)
+	known := paper(`2012ARA&A..50..531K`, `Known already.`)
+	window := testWindow(fetched, missing, known)
+
+	if err := window.FetchAbstracts(); err != nil {
+		t.Fatal(err)
+	}
+	// the papers are left alone until the results reach the event loop
+	if fetched.GetAbstract() != `` {
+		t.Error(`the abstract was set from the background`)
+	}
+	wait(t, window)
+
+	if !strings.Contains(fetched.GetAbstract(), `Measurements of`) {
+		t.Errorf(`abstract = %q`, fetched.GetAbstract())
+	}
+	if missing.GetAbstract() != `` {
+		t.Errorf(`abstract of a missing page = %q`, missing.GetAbstract())
+	}
+	if known.GetAbstract() != `Known already.` {
+		t.Errorf(`known abstract became %q`, known.GetAbstract())
+	}
+	// the paper whose page is missing is reported
+	if !strings.Contains(window.status, `1 of 3 papers failed`) || !strings.Contains(window.status, `2001ApJ...100..100B`) {
+		t.Errorf(`status = %q`, window.status)
+	}
+}
+
+// TestAddToLibraryBusy checks that F7 waits for the task that may be
+// writing the library.
+func TestAddToLibraryBusy(t *testing.T) {
+	os.Setenv(`XDG_DATA_HOME`, t.TempDir())
+	defer os.Unsetenv(`XDG_DATA_HOME`)
+	paper := termads.NewPaper()
+	paper.SetBibcode(`1998ApJ...498..541K`)
+	window := testWindow(paper)
+	window.cancel = func() {}
+
+	if err := window.AddToLibrary(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(termads.DefaultLibraryPath()); !os.IsNotExist(err) {
+		t.Errorf(`the library was written while busy: %v`, err)
+	}
+	if window.status != "Busy. <Esc> to cancel." {
+		t.Errorf(`status = %q`, window.status)
+	}
+
+	window.cancel = nil
+	if err := window.AddToLibrary(); err != nil {
+		t.Fatal(err)
+	}
+	library, err := termads.OpenLibrary(termads.DefaultLibraryPath())
+	if err != nil || library.Get(`1998ApJ...498..541K`) == nil {
+		t.Errorf(`the paper was not added: %v`, err)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"github.com/yurutaso/termads"
+	"strings"
+)
+
+/*
+The results pane lists the papers below the forms, one per line:
+
+	S U Author           Year Journal  Title                    Links
+
+S marks the selected papers and U the unread ones of the library. The
+highlighted line is the cursor; the list scrolls to keep it visible.
+*/
+
+const (
+	focusForm = iota
+	focusResults
+	focusDetail
+)
+
+const (
+	authorWidth  = 16
+	journalWidth = 8
+)
+
+// ToggleFocus moves the keyboard between the forms and the results, or
+// the detail pane if it is open.
+func (window *Window) ToggleFocus() {
+	switch {
+	case window.focus != focusForm:
+		window.focus = focusForm
+	case window.detail != nil:
+		window.focus = focusDetail
+	case len(window.papers) > 0:
+		window.focus = focusResults
+		window.ScrollToCursor()
+	}
+}
+
+// MoveCursor moves the cursor by n results. Going past the last paper
+// loaded fetches more from ADS.
+func (window *Window) MoveCursor(n int) {
+	if len(window.papers) == 0 {
+		return
+	}
+	target := window.cursor + n
+	if target < 0 {
+		target = 0
+	}
+	if target >= len(window.papers) {
+		if window.HasMore() && !window.Busy() {
+			offset := target - window.ResultHeight() + 1
+			if offset < window.offset {
+				offset = window.offset
+			}
+			// the cursor stays on a loaded paper until the page is there
+			window.LoadPage(offset, target)
+			return
+		}
+		target = len(window.papers) - 1
+	}
+	window.cursor = target
+	window.ScrollToCursor()
+}
+
+// HasMore reports whether ADS has papers of the search that are not
+// loaded yet.
+func (window *Window) HasMore() bool {
+	if window.results == nil || window.results.Err() != nil {
+		return false
+	}
+	total := window.results.Total()
+	return total < 0 || len(window.papers) < total
+}
+
+// ScrollToCursor scrolls the list just enough to show the cursor.
+func (window *Window) ScrollToCursor() {
+	if window.cursor < window.offset {
+		window.offset = window.cursor
+	}
+	if height := window.ResultHeight(); window.cursor >= window.offset+height {
+		window.offset = window.cursor - height + 1
+	}
+	if window.results != nil || window.entries != nil {
+		window.UpdatePageStatus()
+	}
+}
+
+// clampCursor keeps the cursor on a loaded paper on the screen, after the
+// list was paged.
+func (window *Window) clampCursor() {
+	last := window.offset + window.ResultHeight() - 1
+	if last >= len(window.papers) {
+		last = len(window.papers) - 1
+	}
+	if window.cursor > last {
+		window.cursor = last
+	}
+	if window.cursor < window.offset {
+		window.cursor = window.offset
+	}
+	if window.cursor < 0 {
+		window.cursor = 0
+	}
+}
+
+// ToggleSelection selects the paper under the cursor, or unselects it,
+// and moves to the next one.
+func (window *Window) ToggleSelection() {
+	if len(window.papers) == 0 {
+		return
+	}
+	bibcode := window.papers[window.cursor].GetBibcode()
+	if window.selected[bibcode] {
+		delete(window.selected, bibcode)
+	} else {
+		window.selected[bibcode] = true
+	}
+	if window.cursor+1 < len(window.papers) {
+		window.cursor++
+	}
+	window.ScrollToCursor()
+}
+
+// SelectedPapers returns the selected papers in the order of the list,
+// or nil if none is.
+func (window *Window) SelectedPapers() []termads.Paper {
+	if len(window.selected) == 0 {
+		return nil
+	}
+	papers := []termads.Paper{}
+	for _, paper := range window.papers {
+		if window.selected[paper.GetBibcode()] {
+			papers = append(papers, paper)
+		}
+	}
+	return papers
+}
+
+// PapersOnScreen returns the selected papers, or else the papers shown.
+func (window *Window) PapersOnScreen() []termads.Paper {
+	if papers := window.SelectedPapers(); papers != nil {
+		return papers
+	}
+	end := window.offset + window.ResultHeight()
+	if end > len(window.papers) {
+		end = len(window.papers)
+	}
+	return window.papers[window.offset:end]
+}
+
+// DrawResults draws the header and the lines of the results on the
+// screen.
+func (window *Window) DrawResults() {
+	if len(window.papers) == 0 {
+		return
+	}
+	width, _ := termbox.Size()
+	header := "Bibcode             Matches"
+	if window.hits == nil {
+		header = fitColumns(width, "Author", "Year", "Journal", "Title", "Links")
+	}
+	drawText(0, resultYoff, "    "+header, termbox.ColorDefault|termbox.AttrUnderline, termbox.ColorDefault)
+	end := window.offset + window.ResultHeight()
+	if end > len(window.papers) {
+		end = len(window.papers)
+	}
+	for i := window.offset; i < end; i++ {
+		y := resultYoff + 1 + i - window.offset
+		fg, bg := termbox.ColorDefault, termbox.ColorDefault
+		if i == window.cursor && window.focus == focusResults {
+			fg |= termbox.AttrReverse
+			// the whole width, so the cursor shows on short lines
+			drawText(0, y, strings.Repeat(" ", width), fg, bg)
+		}
+		x := drawText(0, y, window.marks(i)+" ", fg, bg)
+		if window.hits != nil {
+			hit := window.hits[i]
+			x = drawText(x, y, hit.Bibcode+" ", fg, bg)
+			drawMatches(x, y, hit.Snippet, fg, bg)
+			continue
+		}
+		drawText(x, y, window.resultColumns(i, width), fg, bg)
+	}
+}
+
+// marks returns the selection and unread marks of result i.
+func (window *Window) marks(i int) string {
+	selected, unread := " ", " "
+	if window.selected[window.papers[i].GetBibcode()] {
+		selected = "+"
+	}
+	if window.entries != nil && window.entries[i] != nil && !window.entries[i].Read {
+		unread = "*"
+	}
+	return selected + " " + unread
+}
+
+func (window *Window) resultColumns(i, width int) string {
+	paper := window.papers[i]
+	meta := paper.Metadata()
+	author := ""
+	if authors := paper.GetAuthorList(); len(authors) > 0 {
+		author = authors[0].Last
+	}
+	year := ""
+	if meta.Year > 0 {
+		year = fmt.Sprint(meta.Year)
+	} else if bibcode := paper.GetBibcode(); len(bibcode) >= 4 {
+		year = bibcode[:4]
+	}
+	journal := meta.Bibstem
+	if journal == "" {
+		if bibcode, err := termads.ParseBibcode(paper.GetBibcode()); err == nil {
+			journal = bibcode.Journal
+		}
+	}
+	title := paper.GetTitle()
+	if window.entries != nil && window.entries[i] != nil && len(window.entries[i].Tags) > 0 {
+		title += " [" + strings.Join(window.entries[i].Tags, ", ") + "]"
+	}
+	return fitColumns(width, author, year, journal, title, paper.LinkTypes())
+}
+
+// fitColumns lays out a result line in width, after the marks. The title
+// takes the space left by the other columns.
+func fitColumns(width int, author, year, journal, title, links string) string {
+	linkWidth := len(termads.VALID_LINKS)
+	titleWidth := width - 4 - authorWidth - 1 - 4 - 1 - journalWidth - 1 - 1 - linkWidth
+	if titleWidth < 10 {
+		titleWidth = 10
+	}
+	return fit(author, authorWidth) + " " + fit(year, 4) + " " + fit(journal, journalWidth) + " " +
+		fit(title, titleWidth) + " " + links
+}
+
+// fit pads or cuts s to n columns.
+func fit(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		if n > 3 {
+			return string(runes[:n-3]) + "..."
+		}
+		return string(runes[:n])
+	}
+	return s + strings.Repeat(" ", n-len(runes))
+}
+
+func (window *Window) HandleKeyEventInResult(ev termbox.Event) int {
+	switch ev.Key {
+	// Back to the forms
+	case termbox.KeyTab:
+		window.ToggleFocus()
+	// Motions
+	case termbox.KeyArrowDown, termbox.KeyCtrlN:
+		window.MoveCursor(1)
+	case termbox.KeyArrowUp, termbox.KeyCtrlP:
+		window.MoveCursor(-1)
+	case termbox.KeyHome:
+		window.MoveCursor(-window.cursor)
+	case termbox.KeyEnd:
+		window.MoveCursor(len(window.papers) - 1 - window.cursor)
+	case termbox.KeySpace:
+		window.ToggleSelection()
+	case termbox.KeyEnter:
+		window.OpenDetail()
+	default:
+		switch ev.Ch {
+		case 'j':
+			window.MoveCursor(1)
+		case 'k':
+			window.MoveCursor(-1)
+		case 'l':
+			window.OpenDetail()
+		case 'g':
+			window.MoveCursor(-window.cursor)
+		case 'G':
+			window.MoveCursor(len(window.papers) - 1 - window.cursor)
+		case 'i', '/':
+			window.ToggleFocus()
+		case 'q':
+			return statusExit
+		}
+	}
+	return statusContinue
+}
@@ -0,0 +1,352 @@
+package termads
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*=======================================================
+/*                 PDF downloads
+/*=======================================================*/
+
+const (
+	// Link types tried in order: arXiv first as it is always open, then
+	// the publisher's PDF and its HTML page, which may be paywalled.
+	DEFAULT_PDF_SOURCES = LINKTYPE_ARXIV + LINKTYPE_FULL_ARTICLE + LINKTYPE_ELEC_ARTICLE
+	DEFAULT_PDF_NAME    = `%a%y_%b`
+	ARXIV_PDF_URL       = `https://arxiv.org/pdf/`
+	PDF_MAGIC           = `%PDF-`
+	PARTIAL_SUFFIX      = `.part`
+)
+
+// ErrNotPDF means a link led to something else than a PDF, typically the
+// login page of a publisher.
+var ErrNotPDF = errors.New(`not a PDF`)
+
+type DownloadOptions struct {
+	Dir       string // default DefaultPDFDir()
+	Sources   string // link types to try, in order (default DEFAULT_PDF_SOURCES)
+	Name      string // file name pattern, see PDFName (default DEFAULT_PDF_NAME)
+	Overwrite bool   // download again files that exist
+	// Progress is called while a file is written. total is -1 if the
+	// server does not tell the size.
+	Progress func(p Paper, done, total int64)
+}
+
+// Download is a PDF on disk.
+type Download struct {
+	Paper   Paper
+	Path    string
+	URL     string // where the PDF was finally read from
+	Source  string // link type it was found through
+	Size    int64
+	Resumed bool // a partial download was continued
+	Existed bool // the file was there already; nothing was fetched
+}
+
+// DefaultDataDir returns $XDG_DATA_HOME/termads, or
+// ~/.local/share/termads.
+func DefaultDataDir() string {
+	dir := os.Getenv(`XDG_DATA_HOME`)
+	if dir == `` {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, `.local`, `share`)
+	}
+	return filepath.Join(dir, `termads`)
+}
+
+func DefaultPDFDir() string {
+	return filepath.Join(DefaultDataDir(), `pdf`)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// PDFName builds a file name (with .pdf) for p from pattern where
+//
+//	%a  last name of the first author
+//	%y  four-digit year, %Y two-digit year
+//	%b  bibcode
+func PDFName(p Paper, pattern string) string {
+	meta := p.Metadata()
+	year := ``
+	if meta.Year > 0 {
+		year = strconv.Itoa(meta.Year)
+	} else if bibcode := p.GetBibcode(); len(bibcode) >= 4 {
+		year = bibcode[:4]
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'a':
+			if authors := p.GetAuthorList(); len(authors) > 0 {
+				b.WriteString(asciiLetters(authors[0].Last))
+			}
+		case 'y':
+			b.WriteString(year)
+		case 'Y':
+			if len(year) == 4 {
+				b.WriteString(year[2:])
+			}
+		case 'b':
+			b.WriteString(p.GetBibcode())
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(b.String(), `_`), `_.`)
+	if name == `` {
+		name = `paper`
+	}
+	return name + `.pdf`
+}
+
+// DownloadPDF saves the full text of p. The links of opts.Sources are
+// tried in turn until one gives a PDF; ADS link gateways are followed to
+// the publisher. An interrupted download is kept as NAME.pdf.<type>.part
+// and resumed the next time.
+func (client *Client) DownloadPDF(ctx context.Context, p Paper, opts DownloadOptions) (*Download, error) {
+	if opts.Dir == `` {
+		opts.Dir = DefaultPDFDir()
+	}
+	if opts.Sources == `` {
+		opts.Sources = DEFAULT_PDF_SOURCES
+	}
+	if opts.Name == `` {
+		opts.Name = DEFAULT_PDF_NAME
+	}
+	path := filepath.Join(opts.Dir, PDFName(p, opts.Name))
+	if info, err := os.Stat(path); err == nil && !opts.Overwrite {
+		return &Download{Paper: p, Path: path, Size: info.Size(), Existed: true}, nil
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	failures := []string{}
+	for _, r := range opts.Sources {
+		linktype := string(r)
+		_url := p.GetURLOfType(linktype)
+		if linktype == LINKTYPE_ARXIV && p.Metadata().ArXivID != `` {
+			_url = ARXIV_PDF_URL + p.Metadata().ArXivID
+		}
+		if _url == `` {
+			continue
+		}
+		download, err := client.downloadFrom(ctx, p, _url, path, linktype, opts)
+		if err == nil {
+			return download, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		failures = append(failures, fmt.Sprintf(`%s: %v`, linktype, err))
+	}
+	if len(failures) == 0 {
+		return nil, fmt.Errorf(`PDF of %s: %w (no link of type %s)`, p.GetBibcode(), ErrNotFound, opts.Sources)
+	}
+	return nil, fmt.Errorf(`PDF of %s: %w (%s)`, p.GetBibcode(), ErrNotFound, strings.Join(failures, `; `))
+}
+
+func (client *Client) downloadFrom(ctx context.Context, p Paper, _url, path, linktype string, opts DownloadOptions) (*Download, error) {
+	part := path + `.` + linktype + PARTIAL_SUFFIX
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+	res, err := client.getFrom(ctx, _url, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// the arXiv link of the classic interface leads to the abstract page
+	if abs := res.Request.URL; abs.Host == `arxiv.org` && strings.HasPrefix(abs.Path, `/abs/`) {
+		res.Body.Close()
+		if res, err = client.getFrom(ctx, ARXIV_PDF_URL+strings.TrimPrefix(abs.Path, `/abs/`), offset); err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+	}
+
+	download := &Download{Paper: p, Path: path, URL: res.Request.URL.String(), Source: linktype}
+	flags := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		download.Resumed = true
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the part is complete already
+		download.Resumed = true
+	default:
+		return nil, &StatusError{Code: res.StatusCode}
+	}
+
+	total := int64(-1)
+	if res.ContentLength >= 0 {
+		total = offset + res.ContentLength
+	}
+	if res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		body := bufio.NewReader(res.Body)
+		if offset == 0 {
+			head, _ := body.Peek(len(PDF_MAGIC))
+			if string(head) != PDF_MAGIC {
+				return nil, fmt.Errorf(`%s is %w (%s)`, download.URL, ErrNotPDF, res.Header.Get(`Content-Type`))
+			}
+		}
+		file, err := os.OpenFile(part, flags, 0644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, &progressReader{r: body, done: offset, total: total, report: func(done, total int64) {
+			if opts.Progress != nil {
+				opts.Progress(p, done, total)
+			}
+		}})
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := verifyPDF(part); err != nil {
+		os.Remove(part)
+		return nil, err
+	}
+	info, err := os.Stat(part)
+	if err != nil {
+		return nil, err
+	}
+	download.Size = info.Size()
+	return download, os.Rename(part, path)
+}
+
+// progressReader reports the bytes read so far after each read.
+type progressReader struct {
+	r      io.Reader
+	done   int64
+	total  int64
+	report func(done, total int64)
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.done += int64(n)
+	pr.report(pr.done, pr.total)
+	return n, err
+}
+
+// getFrom requests _url from byte offset on. Unlike requests to ADS it
+// carries no token, since the links lead to other sites.
+func (client *Client) getFrom(ctx context.Context, _url string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, `GET`, _url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client.UserAgent != `` {
+		req.Header.Set(`User-Agent`, client.UserAgent)
+	}
+	if offset > 0 {
+		req.Header.Set(`Range`, fmt.Sprintf(`bytes=%d-`, offset))
+	}
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return client.send(httpClient, req)
+}
+
+// verifyPDF checks the header and that the file ends with %%EOF, as a
+// truncated download would not.
+func verifyPDF(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	head := make([]byte, len(PDF_MAGIC))
+	if _, err := io.ReadFull(file, head); err != nil || string(head) != PDF_MAGIC {
+		return fmt.Errorf(`%s: %w`, path, ErrNotPDF)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	tail := int64(1024)
+	if info.Size() < tail {
+		tail = info.Size()
+	}
+	buf := make([]byte, tail)
+	if _, err := file.ReadAt(buf, info.Size()-tail); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(buf, []byte(`%%EOF`)) {
+		return fmt.Errorf(`%s: %w (truncated, no %%%%EOF)`, path, ErrNotPDF)
+	}
+	return nil
+}
+
+// DownloadPDFs downloads the PDFs of papers one after another. The
+// downloads are in the order of papers, nil where it failed; failures do
+// not stop the others and are reported by a *DownloadError.
+func (client *Client) DownloadPDFs(ctx context.Context, papers []Paper, opts DownloadOptions) ([]*Download, error) {
+	downloads := make([]*Download, len(papers))
+	failed := map[string]error{}
+	for i, p := range papers {
+		download, err := client.DownloadPDF(ctx, p, opts)
+		if ctx.Err() != nil {
+			return downloads, ctx.Err()
+		}
+		if err != nil {
+			failed[p.GetBibcode()] = err
+			continue
+		}
+		downloads[i] = download
+	}
+	if len(failed) > 0 {
+		return downloads, &DownloadError{Failed: failed, Total: len(papers)}
+	}
+	return downloads, nil
+}
+
+// DownloadError reports the papers whose PDF could not be downloaded,
+// by bibcode.
+type DownloadError struct {
+	Failed map[string]error
+	Total  int
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf(`%d of %d PDFs could not be downloaded`, len(e.Failed), e.Total)
+}
+
+func DownloadPDF(ctx context.Context, p Paper, opts DownloadOptions) (*Download, error) {
+	return DefaultClient.DownloadPDF(ctx, p, opts)
+}
+
+func DownloadPDFs(ctx context.Context, papers []Paper, opts DownloadOptions) ([]*Download, error) {
+	return DefaultClient.DownloadPDFs(ctx, papers, opts)
+}
@@ -0,0 +1,156 @@
+package termads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPDF = []byte("%PDF-1.4\n" + strings.Repeat("1 0 obj << >> endobj\n", 100) + "trailer\n%%EOF\n")
+
+// pdfServer serves testPDF with range requests at /paper.pdf, ignores
+// ranges at /whole.pdf, and serves a login page at /login and a
+// truncated PDF at /truncated.pdf. It records the Range headers.
+func pdfServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	ranges := &[]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get(`Range`))
+		switch r.URL.Path {
+		case `/paper.pdf`:
+			http.ServeContent(w, r, `paper.pdf`, time.Time{}, bytes.NewReader(testPDF))
+		case `/whole.pdf`:
+			w.Header().Set(`Content-Length`, strconv.Itoa(len(testPDF)))
+			w.Write(testPDF)
+		case `/login`:
+			w.Header().Set(`Content-Type`, `text/html`)
+			w.Write([]byte(`<html>Please sign in</html>`))
+		case `/truncated.pdf`:
+			w.Write(testPDF[:len(testPDF)/2])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, ranges
+}
+
+func pdfPaper(links map[string]string) Paper {
+	p := NewPaper()
+	p.SetBibcode(`2020ApJ...900....1A`)
+	for linktype, _url := range links {
+		p.SetURL(_url, linktype)
+	}
+	return p
+}
+
+func TestDownloadPDF(t *testing.T) {
+	server, ranges := pdfServer(t)
+	client := NewClient()
+	client.Limiter = nil
+	client.Retry = nil
+	dir := t.TempDir()
+	path := filepath.Join(dir, `2020ApJ...900....1A.pdf`)
+	part := path + `.` + LINKTYPE_FULL_ARTICLE + PARTIAL_SUFFIX
+	opts := DownloadOptions{Dir: dir, Name: `%b`, Sources: LINKTYPE_FULL_ARTICLE}
+
+	tests := []struct {
+		name    string
+		link    string
+		part    []byte // left by an earlier download
+		rng     string // the Range requested
+		resumed bool
+	}{
+		{`fresh`, `/paper.pdf`, nil, ``, false},
+		{`resume`, `/paper.pdf`, testPDF[:100], `bytes=100-`, true},
+		{`already complete`, `/paper.pdf`, testPDF, `bytes=` + strconv.Itoa(len(testPDF)) + `-`, true},
+		{`range ignored`, `/whole.pdf`, []byte(`%PDF-garbage`), `bytes=12-`, false},
+	}
+	for _, tt := range tests {
+		os.Remove(path)
+		if tt.part != nil {
+			if err := ioutil.WriteFile(part, tt.part, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		*ranges = nil
+		var done, total int64
+		opts.Progress = func(p Paper, d, t int64) { done, total = d, t }
+		download, err := client.DownloadPDF(context.Background(), pdfPaper(map[string]string{LINKTYPE_FULL_ARTICLE: server.URL + tt.link}), opts)
+		if err != nil {
+			t.Errorf(`%s: %v`, tt.name, err)
+			continue
+		}
+		if download.Path != path || download.Resumed != tt.resumed || download.Size != int64(len(testPDF)) ||
+			download.Source != LINKTYPE_FULL_ARTICLE || download.URL != server.URL+tt.link || download.Existed {
+			t.Errorf(`%s: download = %+v`, tt.name, download)
+		}
+		if len(*ranges) != 1 || (*ranges)[0] != tt.rng {
+			t.Errorf(`%s: Range = %q, want %q`, tt.name, *ranges, tt.rng)
+		}
+		if data, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(data, testPDF) {
+			t.Errorf(`%s: the file is not the PDF (%d bytes, %v)`, tt.name, len(data), err)
+		}
+		if len(tt.part) < len(testPDF) {
+			if done != int64(len(testPDF)) || total != int64(len(testPDF)) {
+				t.Errorf(`%s: progress %d/%d`, tt.name, done, total)
+			}
+		}
+		assertFiles(t, dir, filepath.Base(path))
+	}
+
+	// a file that exists is not fetched again
+	*ranges = nil
+	download, err := client.DownloadPDF(context.Background(), pdfPaper(map[string]string{LINKTYPE_FULL_ARTICLE: server.URL + `/paper.pdf`}), opts)
+	if err != nil || !download.Existed || len(*ranges) != 0 {
+		t.Errorf(`existing file: %+v, %v after %d requests`, download, err, len(*ranges))
+	}
+}
+
+func TestDownloadPDFNotPDF(t *testing.T) {
+	server, _ := pdfServer(t)
+	client := NewClient()
+	client.Limiter = nil
+	client.Retry = nil
+	dir := t.TempDir()
+	opts := DownloadOptions{Dir: dir, Name: `%b`}
+
+	// the login page of the publisher and a truncated file are refused,
+	// and the next source is tried
+	p := pdfPaper(map[string]string{
+		LINKTYPE_FULL_ARTICLE: server.URL + `/login`,
+		LINKTYPE_ELEC_ARTICLE: server.URL + `/truncated.pdf`,
+	})
+	_, err := client.DownloadPDF(context.Background(), p, opts)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf(`err = %v, want ErrNotFound`, err)
+	}
+	for _, want := range []string{LINKTYPE_FULL_ARTICLE + `: ` + server.URL + `/login is not a PDF (text/html)`, LINKTYPE_ELEC_ARTICLE + `: `, `truncated, no %%EOF`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf(`err = %v, want %q in it`, err, want)
+		}
+	}
+	// nothing is left behind, so the next attempt starts afresh
+	assertFiles(t, dir)
+
+	p.SetURL(server.URL+`/missing.pdf`, LINKTYPE_FULL_ARTICLE)
+	p.SetURL(server.URL+`/paper.pdf`, LINKTYPE_ELEC_ARTICLE)
+	download, err := client.DownloadPDF(context.Background(), p, opts)
+	if err != nil || download.Source != LINKTYPE_ELEC_ARTICLE {
+		t.Errorf(`fallback: %+v, %v`, download, err)
+	}
+
+	opts.Dir = t.TempDir()
+	if _, err := client.DownloadPDF(context.Background(), pdfPaper(nil), opts); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), `no link of type`) {
+		t.Errorf(`no links: err = %v`, err)
+	}
+}
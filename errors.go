@@ -0,0 +1,154 @@
+package termads
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*=======================================================
+/*                    Errors
+/*=======================================================*/
+
+// Sentinel errors. Errors returned by the package match one of these with
+// errors.Is when the cause is known.
+var (
+	ErrNotFound     = errors.New(`not found`)
+	ErrRateLimited  = errors.New(`rate limited by ADS`)
+	ErrUnauthorized = errors.New(`unauthorized`)
+	ErrParse        = errors.New(`cannot parse`)
+	ErrInvalidField = errors.New(`invalid field`)
+	ErrOffline      = errors.New(`not in cache (offline)`)
+)
+
+// ParseError means a response from ADS or a file did not have the
+// expected layout.
+type ParseError struct {
+	What    string // e.g. "abstract page"
+	Msg     string
+	Snippet string // text around the problem
+}
+
+func (e *ParseError) Error() string {
+	s := `cannot parse ` + e.What
+	if e.Msg != `` {
+		s += `: ` + e.Msg
+	}
+	if e.Snippet != `` {
+		s += fmt.Sprintf(` near %q`, e.Snippet)
+	}
+	return s
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+const SNIPPET_LENGTH int = 60
+
+// snippet returns about SNIPPET_LENGTH characters of text from pos on,
+// with runs of white space collapsed.
+func snippet(text string, pos int) string {
+	if pos < 0 || pos > len(text) {
+		pos = 0
+	}
+	s := strings.Join(strings.Fields(text[pos:]), ` `)
+	if r := []rune(s); len(r) > SNIPPET_LENGTH {
+		s = string(r[:SNIPPET_LENGTH]) + `...`
+	}
+	return s
+}
+
+// StatusError is an HTTP error status from ADS.
+type StatusError struct {
+	Code int
+	Msg  string // message of the API, if any
+}
+
+func (e *StatusError) Error() string {
+	s := fmt.Sprintf(`ADS returned %d %s`, e.Code, http.StatusText(e.Code))
+	if e.Msg != `` {
+		s += `: ` + e.Msg
+	}
+	return s
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch e.Code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return target == ErrUnauthorized
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
+
+// FieldError is an invalid value given by the caller.
+type FieldError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf(`invalid %s "%s": %s`, e.Field, e.Value, e.Reason)
+}
+
+func (e *FieldError) Is(target error) bool {
+	return target == ErrInvalidField
+}
+
+/*=======================================================
+/*                 Exit codes
+/*=======================================================*/
+
+// Exit codes of the commands.
+const (
+	EXIT_OK           = 0
+	EXIT_ERROR        = 1
+	EXIT_USAGE        = 2
+	EXIT_NOT_FOUND    = 3
+	EXIT_UNAUTHORIZED = 4
+	EXIT_RATE_LIMITED = 5
+	EXIT_PARSE        = 6
+	EXIT_OFFLINE      = 7
+)
+
+// ExitCode maps an error to the exit status of a command.
+func ExitCode(err error) int {
+	var serr *QuerySyntaxError
+	switch {
+	case err == nil:
+		return EXIT_OK
+	case errors.As(err, &serr), errors.Is(err, ErrInvalidField):
+		return EXIT_USAGE
+	case errors.Is(err, ErrNotFound):
+		return EXIT_NOT_FOUND
+	case errors.Is(err, ErrUnauthorized):
+		return EXIT_UNAUTHORIZED
+	case errors.Is(err, ErrRateLimited):
+		return EXIT_RATE_LIMITED
+	case errors.Is(err, ErrParse):
+		return EXIT_PARSE
+	case errors.Is(err, ErrOffline):
+		return EXIT_OFFLINE
+	}
+	return EXIT_ERROR
+}
+
+// ErrorHint returns a line telling the user what to do about err, or ""
+// if there is nothing to add to the message.
+func ErrorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return `check the ADS API token (-token or $ADS_API_TOKEN)`
+	case errors.Is(err, ErrRateLimited):
+		return `the ADS API quota is used up; try again later`
+	case errors.Is(err, ErrOffline):
+		return `run without -offline to fetch it`
+	}
+	return ``
+}
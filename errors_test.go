@@ -0,0 +1,30 @@
+package termads
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExitCodeAndHint(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+		hint string
+	}{
+		{nil, EXIT_OK, ``},
+		{fmt.Errorf(`search: %w`, &StatusError{Code: 401}), EXIT_UNAUTHORIZED, `token`},
+		{&StatusError{Code: 429}, EXIT_RATE_LIMITED, `quota`},
+		{fmt.Errorf(`BibTeX of X: %w`, ErrOffline), EXIT_OFFLINE, `-offline`},
+		{&FieldError{Field: `year`}, EXIT_USAGE, ``},
+		{fmt.Errorf(`bibcode: %w`, ErrNotFound), EXIT_NOT_FOUND, ``},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.code {
+			t.Errorf(`ExitCode(%v) = %d, want %d`, tt.err, got, tt.code)
+		}
+		if got := ErrorHint(tt.err); (tt.hint == ``) != (got == ``) || !strings.Contains(got, tt.hint) {
+			t.Errorf(`ErrorHint(%v) = %q, want a hint with %q`, tt.err, got, tt.hint)
+		}
+	}
+}
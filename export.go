@@ -0,0 +1,203 @@
+package termads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	ADS_EXPORT_URL    = `https://api.adsabs.harvard.edu/v1/export`
+	BIBTEX_BATCH_SIZE = 200
+)
+
+/*=======================================================
+/*                 Batch BibTeX export
+/*=======================================================*/
+
+// GetBibTexBatch retrieves the BibTeX entries of many bibcodes with as
+// few requests as possible. The entries are keyed by the bibcodes as
+// given; bibcodes for which ADS returned nothing, and those that are not
+// valid bibcodes, are listed in missing.
+func (client *Client) GetBibTexBatch(bibcodes []string) (map[string]string, []string, error) {
+	return client.GetBibTexBatchContext(context.Background(), bibcodes)
+}
+
+func (client *Client) GetBibTexBatchContext(ctx context.Context, bibcodes []string) (entries map[string]string, missing []string, err error) {
+	// invalid bibcodes stay empty and end up missing
+	normalized := make([]string, len(bibcodes))
+	for i, bibcode := range bibcodes {
+		normalized[i], _ = NormalizeBibcode(bibcode)
+	}
+	// Cached entries are kept per bibcode; only the others are fetched.
+	// Offline, bibcodes that are not in the cache are reported missing.
+	found := map[string]string{}
+	fetch := []string{}
+	for _, bibcode := range normalized {
+		if _, ok := found[bibcode]; ok || bibcode == `` {
+			continue
+		}
+		if data, ok := client.Cache.Get(CACHE_EXPORT, `bibtex `+bibcode); ok {
+			found[bibcode] = string(data)
+		} else if !client.Cache.IsOffline() {
+			fetch = append(fetch, bibcode)
+		}
+	}
+	for start := 0; start < len(fetch); start += BIBTEX_BATCH_SIZE {
+		end := start + BIBTEX_BATCH_SIZE
+		if end > len(fetch) {
+			end = len(fetch)
+		}
+		text, err := client.fetchBibTex(ctx, fetch[start:end])
+		if err != nil {
+			return nil, nil, err
+		}
+		file, err := ParseBibTex(text)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range file.Entries() {
+			bibcode := strings.Replace(entry.Key, `\&`, `&`, -1)
+			found[bibcode] = entry.String()
+			client.Cache.Put(CACHE_EXPORT, `bibtex `+bibcode, []byte(entry.String()))
+		}
+	}
+	entries = map[string]string{}
+	missing = []string{}
+	for i, bibcode := range bibcodes {
+		if entry, ok := found[normalized[i]]; ok {
+			entries[bibcode] = entry
+		} else {
+			missing = append(missing, bibcode)
+		}
+	}
+	return entries, missing, nil
+}
+
+// ExportBibTex returns the BibTeX of papers in their order, together with
+// the bibcodes ADS had no entry for.
+func (client *Client) ExportBibTex(papers []Paper) (string, []string, error) {
+	return client.ExportBibTexContext(context.Background(), papers)
+}
+
+func (client *Client) ExportBibTexContext(ctx context.Context, papers []Paper) (string, []string, error) {
+	bibcodes := make([]string, len(papers))
+	for i, paper := range papers {
+		bibcodes[i] = paper.GetBibcode()
+	}
+	entries, missing, err := client.GetBibTexBatchContext(ctx, bibcodes)
+	if err != nil {
+		return "", nil, err
+	}
+	bibtex := []string{}
+	for _, bibcode := range bibcodes {
+		if entry, ok := entries[bibcode]; ok {
+			bibtex = append(bibtex, entry)
+		}
+	}
+	return strings.Join(bibtex, "\n\n"), missing, nil
+}
+
+func (client *Client) fetchBibTex(ctx context.Context, bibcodes []string) (string, error) {
+	if client.Token != "" {
+		return client.postExport(ctx, `bibtex`, bibcodes)
+	}
+	values := url.Values{}
+	for _, bibcode := range bibcodes {
+		values.Add(`bibcode`, bibcode)
+	}
+	values.Add(`data_type`, `BIBTEX`)
+	values.Add(`db_key`, `AST`)
+	values.Add(`nocookieset`, `1`)
+	res, err := client.postForm(ctx, client.BibURL, values)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", &StatusError{Code: res.StatusCode}
+	}
+
+	doc, err := goquery.NewDocumentFromResponse(res)
+	if err != nil {
+		return "", err
+	}
+	text := doc.Find("body").Text()
+	if i := strings.Index(text, `@`); i >= 0 {
+		return text[i:], nil
+	}
+	return "", nil
+}
+
+// fetchExport is postExport through the cache, keyed by the format and
+// the bibcodes.
+func (client *Client) fetchExport(ctx context.Context, format string, bibcodes []string) (string, error) {
+	key := format + ` ` + strings.Join(bibcodes, `;`)
+	if data, ok := client.Cache.Get(CACHE_EXPORT, key); ok {
+		return string(data), nil
+	}
+	if client.Cache.IsOffline() {
+		return "", fmt.Errorf(`%s export: %w`, format, ErrOffline)
+	}
+	text, err := client.postExport(ctx, format, bibcodes)
+	if err != nil {
+		return "", err
+	}
+	client.Cache.Put(CACHE_EXPORT, key, []byte(text))
+	return text, nil
+}
+
+// postExport posts bibcodes to /export/<format> of the JSON API.
+func (client *Client) postExport(ctx context.Context, format string, bibcodes []string) (string, error) {
+	body, err := json.Marshal(map[string][]string{`bibcode`: bibcodes})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, `POST`, client.ExportURL+`/`+format, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+	res, err := client.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var export struct {
+		Export string `json:"export"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return "", &StatusError{Code: res.StatusCode}
+		}
+		return "", &ParseError{What: `ADS export response`, Msg: err.Error(), Snippet: snippet(string(data), 0)}
+	}
+	if export.Error != "" || res.StatusCode != http.StatusOK {
+		return "", &StatusError{Code: res.StatusCode, Msg: export.Error}
+	}
+	return export.Export, nil
+}
+
+func GetBibTexBatch(bibcodes []string) (map[string]string, []string, error) {
+	return DefaultClient.GetBibTexBatch(bibcodes)
+}
+
+func GetBibTexBatchContext(ctx context.Context, bibcodes []string) (map[string]string, []string, error) {
+	return DefaultClient.GetBibTexBatchContext(ctx, bibcodes)
+}
+
+func ExportBibTex(papers []Paper) (string, []string, error) {
+	return DefaultClient.ExportBibTex(papers)
+}
@@ -0,0 +1,64 @@
+package termads
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetBibTexBatchInvalidBibcode(t *testing.T) {
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Bibcode []string `json:"bibcode"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		posted = body.Bibcode
+		json.NewEncoder(w).Encode(map[string]string{
+			`export`: "@ARTICLE{1998ApJ...498..541K,\n  author = {{Kennicutt}, Jr., Robert C.},\n  title = \"{The Global Schmidt Law in Star-forming Galaxies}\",\n  year = 1998\n}\n",
+		})
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.ExportURL = server.URL
+	client.Token = `test-token`
+	client.Limiter = nil
+	client.Retry = nil
+
+	entries, missing, err := client.GetBibTexBatch([]string{`1998ApJ...498..541K`, `not a bibcode`, `2012ARA&A..50..531K`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`1998ApJ...498..541K`, `2012ARA&A..50..531K`}; !reflect.DeepEqual(posted, want) {
+		t.Errorf(`posted %q, want %q`, posted, want)
+	}
+	if _, ok := entries[`1998ApJ...498..541K`]; !ok || len(entries) != 1 {
+		t.Errorf(`entries for %v, want only 1998ApJ...498..541K`, reflect.ValueOf(entries).MapKeys())
+	}
+	if want := []string{`not a bibcode`, `2012ARA&A..50..531K`}; !reflect.DeepEqual(missing, want) {
+		t.Errorf(`missing = %q, want %q`, missing, want)
+	}
+}
+
+// TestBibTexCacheKey checks that both interfaces share the cached entry
+// of a bibcode, however it is spelled.
+func TestBibTexCacheKey(t *testing.T) {
+	client, _ := fixtureClient(t, `bibtex_1998ApJ_498_541K`)
+	client.Cache = NewCache(t.TempDir())
+	entry, err := client.GetBibTex(`1998ApJ 498 541K`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Cache.Offline = true
+	if cached, err := client.GetBibTex(`1998ApJ.498.541K`); err != nil || cached != entry {
+		t.Errorf(`classic, offline: %q, %v`, cached, err)
+	}
+	client.Token = `test-token`
+	entries, missing, err := client.GetBibTexBatch([]string{`1998ApJ...498..541K`})
+	if err != nil || len(missing) != 0 || entries[`1998ApJ...498..541K`] != entry {
+		t.Errorf(`API, offline: %q, missing %q, %v`, entries, missing, err)
+	}
+}
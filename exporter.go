@@ -0,0 +1,384 @@
+package termads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	FORMAT_BIBTEX   = `bibtex`
+	FORMAT_RIS      = `ris`
+	FORMAT_ENDNOTE  = `endnote`
+	FORMAT_AASTEX   = `aastex`
+	FORMAT_MNRAS    = `mnras`
+	FORMAT_ICARUS   = `icarus`
+	FORMAT_CSL_JSON = `csl-json`
+	FORMAT_PLAIN    = `plain`
+)
+
+var EXPORT_FORMATS = []string{FORMAT_BIBTEX, FORMAT_RIS, FORMAT_ENDNOTE, FORMAT_AASTEX, FORMAT_MNRAS, FORMAT_ICARUS, FORMAT_CSL_JSON, FORMAT_PLAIN}
+
+// Formats served by /export/<format> of the JSON API.
+var adsExportFormats = map[string]bool{
+	FORMAT_BIBTEX:  true,
+	FORMAT_RIS:     true,
+	FORMAT_ENDNOTE: true,
+	FORMAT_AASTEX:  true,
+	FORMAT_MNRAS:   true,
+	FORMAT_ICARUS:  true,
+}
+
+/*=======================================================
+/*                    Exporter
+/*=======================================================*/
+
+// Exporter renders papers as references in one format.
+type Exporter interface {
+	Format() string
+	Export(papers []Paper) (string, error)
+	ExportContext(ctx context.Context, papers []Paper) (string, error)
+}
+
+// Exporter returns an exporter for format. ADS generates the output when
+// it can (BibTeX, or any supported format with a token); otherwise it is
+// built locally from the paper metadata.
+func (client *Client) Exporter(format string) (Exporter, error) {
+	format = strings.ToLower(format)
+	if format == FORMAT_BIBTEX || (client.Token != "" && adsExportFormats[format]) {
+		return &adsExporter{client: client, format: format}, nil
+	}
+	return LocalExporter(format)
+}
+
+// LocalExporter returns an exporter that needs no network access.
+func LocalExporter(format string) (Exporter, error) {
+	switch strings.ToLower(format) {
+	case FORMAT_BIBTEX:
+		return &localExporter{FORMAT_BIBTEX, bibtexEntry, "\n\n"}, nil
+	case FORMAT_RIS:
+		return &localExporter{FORMAT_RIS, risEntry, "\n"}, nil
+	case FORMAT_ENDNOTE:
+		return &localExporter{FORMAT_ENDNOTE, endnoteEntry, "\n"}, nil
+	case FORMAT_AASTEX:
+		return &localExporter{FORMAT_AASTEX, aastexEntry, "\n"}, nil
+	case FORMAT_MNRAS:
+		return &localExporter{FORMAT_MNRAS, mnrasEntry, "\n"}, nil
+	case FORMAT_ICARUS:
+		return &localExporter{FORMAT_ICARUS, icarusEntry, "\n"}, nil
+	case FORMAT_PLAIN:
+		return &localExporter{FORMAT_PLAIN, plainEntry, "\n"}, nil
+	case FORMAT_CSL_JSON:
+		return cslJSONExporter{}, nil
+	}
+	return nil, &FieldError{Field: `export format`, Value: format, Reason: `must be one of ` + strings.Join(EXPORT_FORMATS, `, `)}
+}
+
+type adsExporter struct {
+	client *Client
+	format string
+}
+
+func (e *adsExporter) Format() string {
+	return e.format
+}
+
+func (e *adsExporter) Export(papers []Paper) (string, error) {
+	return e.ExportContext(context.Background(), papers)
+}
+
+func (e *adsExporter) ExportContext(ctx context.Context, papers []Paper) (string, error) {
+	if e.format == FORMAT_BIBTEX {
+		bibtex, missing, err := e.client.ExportBibTexContext(ctx, papers)
+		if err != nil {
+			return "", err
+		}
+		if len(missing) > 0 {
+			return bibtex, fmt.Errorf(`no BibTeX entry for %s: %w`, strings.Join(missing, `, `), ErrNotFound)
+		}
+		return bibtex, nil
+	}
+	bibcodes := make([]string, len(papers))
+	for i, paper := range papers {
+		bibcodes[i] = paper.GetBibcode()
+	}
+	chunks := []string{}
+	for start := 0; start < len(bibcodes); start += BIBTEX_BATCH_SIZE {
+		end := start + BIBTEX_BATCH_SIZE
+		if end > len(bibcodes) {
+			end = len(bibcodes)
+		}
+		text, err := e.client.fetchExport(ctx, e.format, bibcodes[start:end])
+		if err != nil {
+			return "", err
+		}
+		chunks = append(chunks, strings.TrimSpace(text))
+	}
+	return strings.Join(chunks, "\n"), nil
+}
+
+type localExporter struct {
+	format string
+	entry  func(Paper) string
+	sep    string
+}
+
+func (e *localExporter) Format() string {
+	return e.format
+}
+
+func (e *localExporter) Export(papers []Paper) (string, error) {
+	entries := make([]string, len(papers))
+	for i, paper := range papers {
+		entries[i] = e.entry(paper)
+	}
+	return strings.Join(entries, e.sep), nil
+}
+
+// ExportContext is Export; local exporters do not use the network.
+func (e *localExporter) ExportContext(ctx context.Context, papers []Paper) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return e.Export(papers)
+}
+
+/*=======================================================
+/*                 Local formatters
+/*=======================================================*/
+
+func paperURL(p Paper) string {
+	return ADS_UI_URL + `/abs/` + p.GetBibcode()
+}
+
+func risEntry(p Paper) string {
+	meta := p.Metadata()
+	lines := []string{`TY  - JOUR`}
+	for _, author := range meta.Authors {
+		lines = append(lines, `AU  - `+author.String())
+	}
+	add := func(tag, value string) {
+		if value != "" {
+			lines = append(lines, tag+`  - `+value)
+		}
+	}
+	if meta.Year > 0 {
+		add(`PY`, fmt.Sprint(meta.Year))
+	}
+	add(`TI`, p.GetTitle())
+	add(`JO`, meta.Bibstem)
+	add(`VL`, meta.Volume)
+	add(`SP`, meta.Page)
+	add(`DO`, meta.DOI)
+	for _, keyword := range meta.Keywords {
+		add(`KW`, keyword)
+	}
+	add(`UR`, paperURL(p))
+	add(`AB`, p.GetAbstract())
+	add(`ID`, p.GetBibcode())
+	return strings.Join(append(lines, `ER  - `), "\n") + "\n"
+}
+
+func endnoteEntry(p Paper) string {
+	meta := p.Metadata()
+	lines := []string{`%0 Journal Article`}
+	for _, author := range meta.Authors {
+		lines = append(lines, `%A `+author.String())
+	}
+	add := func(tag, value string) {
+		if value != "" {
+			lines = append(lines, tag+` `+value)
+		}
+	}
+	if meta.Year > 0 {
+		add(`%D`, fmt.Sprint(meta.Year))
+	}
+	add(`%T`, p.GetTitle())
+	add(`%J`, meta.Bibstem)
+	add(`%V`, meta.Volume)
+	add(`%P`, meta.Page)
+	add(`%R`, meta.DOI)
+	for _, keyword := range meta.Keywords {
+		add(`%K`, keyword)
+	}
+	add(`%U`, paperURL(p))
+	add(`%X`, p.GetAbstract())
+	add(`%F`, p.GetBibcode())
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func aastexEntry(p Paper) string {
+	meta := p.Metadata()
+	label := ``
+	switch n := len(meta.Authors); {
+	case n == 1:
+		label = meta.Authors[0].Last
+	case n == 2:
+		label = meta.Authors[0].Last + ` \& ` + meta.Authors[1].Last
+	case n > 2:
+		label = meta.Authors[0].Last + ` et al.`
+	}
+	names := []string{}
+	for _, author := range meta.Authors {
+		names = append(names, author.Last+`, `+strings.Replace(author.Initials(), ` `, `~`, -1))
+	}
+	authors := joinAuthors(names, 5, `, \& `, `, et al.`)
+	qualifier := ``
+	if b, err := ParseBibcode(p.GetBibcode()); err == nil {
+		qualifier = b.Qualifier
+	}
+	return fmt.Sprintf(`\bibitem[%s(%d)]{%s} %s\ %d, %s`, label, meta.Year, p.GetBibcode(), authors, meta.Year,
+		joinNonEmpty(`, `, JournalMacro(meta.Bibstem, qualifier), meta.Volume, meta.Page))
+}
+
+func mnrasEntry(p Paper) string {
+	meta := p.Metadata()
+	names := []string{}
+	for _, author := range meta.Authors {
+		names = append(names, strings.TrimSpace(author.Last+` `+author.Initials()))
+	}
+	authors := joinAuthors(names, 8, `, `, ` et al.`)
+	return joinNonEmpty(`, `, authors, fmt.Sprint(meta.Year), meta.Bibstem, meta.Volume, meta.Page)
+}
+
+func icarusEntry(p Paper) string {
+	meta := p.Metadata()
+	names := []string{}
+	for _, author := range meta.Authors {
+		names = append(names, author.Last+`, `+strings.Replace(author.Initials(), ` `, ``, -1))
+	}
+	authors := joinAuthors(names, 10, `, `, `, et al.`)
+	s := fmt.Sprintf(`%s, %d.`, authors, meta.Year)
+	if title := strings.TrimSpace(p.GetTitle()); title != "" {
+		s += ` ` + strings.TrimRight(title, `.`) + `.`
+	}
+	if source := joinNonEmpty(` `, meta.Bibstem, joinNonEmpty(`, `, meta.Volume, meta.Page)); source != "" {
+		s += ` ` + source + `.`
+	}
+	return s
+}
+
+func plainEntry(p Paper) string {
+	meta := p.Metadata()
+	names := []string{}
+	for _, author := range meta.Authors {
+		names = append(names, strings.TrimSpace(author.Last+`, `+author.Initials()))
+	}
+	authors := joinAuthors(names, 3, `, & `, `, et al.`)
+	s := authors
+	if meta.Year > 0 {
+		s += fmt.Sprintf(` %d`, meta.Year)
+	}
+	if title := strings.TrimSpace(p.GetTitle()); title != "" {
+		s += `, "` + title + `"`
+	}
+	if source := joinNonEmpty(`, `, meta.Bibstem, meta.Volume, meta.Page); source != "" {
+		s += `, ` + source
+	}
+	return s
+}
+
+// joinAuthors joins names with ", " and last before the final name. More
+// than max names collapse to the first one followed by etal.
+func joinAuthors(names []string, max int, last, etal string) string {
+	switch {
+	case len(names) == 0:
+		return ``
+	case len(names) > max:
+		return names[0] + etal
+	case len(names) == 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], `, `) + last + names[len(names)-1]
+}
+
+func joinNonEmpty(sep string, values ...string) string {
+	nonEmpty := []string{}
+	for _, value := range values {
+		if value != "" && value != "0" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
+
+/*=======================================================
+/*                    CSL-JSON
+/*=======================================================*/
+
+type cslName struct {
+	Family string `json:"family,omitempty"`
+	Given  string `json:"given,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+type cslItem struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	Title          string    `json:"title,omitempty"`
+	Author         []cslName `json:"author,omitempty"`
+	Issued         *cslDate  `json:"issued,omitempty"`
+	ContainerTitle string    `json:"container-title,omitempty"`
+	Volume         string    `json:"volume,omitempty"`
+	Page           string    `json:"page,omitempty"`
+	DOI            string    `json:"DOI,omitempty"`
+	URL            string    `json:"URL,omitempty"`
+	Abstract       string    `json:"abstract,omitempty"`
+	Keyword        string    `json:"keyword,omitempty"`
+}
+
+type cslJSONExporter struct{}
+
+func (cslJSONExporter) Format() string {
+	return FORMAT_CSL_JSON
+}
+
+func (e cslJSONExporter) ExportContext(ctx context.Context, papers []Paper) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return e.Export(papers)
+}
+
+func (cslJSONExporter) Export(papers []Paper) (string, error) {
+	items := make([]cslItem, len(papers))
+	for i, p := range papers {
+		meta := p.Metadata()
+		item := cslItem{
+			ID:             p.GetBibcode(),
+			Type:           `article-journal`,
+			Title:          p.GetTitle(),
+			ContainerTitle: meta.Bibstem,
+			Volume:         meta.Volume,
+			Page:           meta.Page,
+			DOI:            meta.DOI,
+			URL:            paperURL(p),
+			Abstract:       p.GetAbstract(),
+			Keyword:        strings.Join(meta.Keywords, `, `),
+		}
+		for _, author := range meta.Authors {
+			item.Author = append(item.Author, cslName{Family: author.Last, Given: author.First})
+		}
+		if meta.Year > 0 {
+			parts := []int{meta.Year}
+			if meta.Month > 0 {
+				parts = append(parts, meta.Month)
+			}
+			item.Issued = &cslDate{DateParts: [][]int{parts}}
+		}
+		items[i] = item
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(``, `  `)
+	if err := encoder.Encode(items); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
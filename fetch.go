@@ -0,0 +1,147 @@
+package termads
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*=======================================================
+/*           Concurrent abstract and BibTeX fetching
+/*=======================================================*/
+
+const DEFAULT_FETCH_WORKERS int = 4
+
+type FetchOptions struct {
+	Abstract bool          // call SetAbstractFromADS
+	BibTex   bool          // fetch the BibTeX entry
+	Workers  int           // number of concurrent requests (default DEFAULT_FETCH_WORKERS)
+	Timeout  time.Duration // per request; 0 for none
+	// Progress is called after each paper, from the worker goroutines,
+	// with the number of papers done so far.
+	Progress func(done, total int, result *FetchResult)
+}
+
+// FetchResult holds what was fetched for one paper. The abstract is set
+// on the paper itself.
+type FetchResult struct {
+	Index       int
+	Paper       Paper
+	BibTex      string
+	AbstractErr error
+	BibTexErr   error
+}
+
+// Err returns the first error of the result.
+func (result *FetchResult) Err() error {
+	if result.AbstractErr != nil {
+		return result.AbstractErr
+	}
+	return result.BibTexErr
+}
+
+// FetchError reports the papers that could not be fetched completely.
+type FetchError struct {
+	Failed []*FetchResult
+	Total  int
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf(`%d of %d papers failed, first %s: %v`,
+		len(e.Failed), e.Total, e.Failed[0].Paper.GetBibcode(), e.Failed[0].Err())
+}
+
+// Unwrap returns the error of the first failed paper.
+func (e *FetchError) Unwrap() error {
+	return e.Failed[0].Err()
+}
+
+// FetchDetails fetches abstracts and/or BibTeX of papers with a bounded
+// number of workers. The results are in the order of papers. Failures do
+// not stop the other papers; they are reported in the results and by a
+// *FetchError. If ctx is cancelled, the papers not started yet fail with
+// ctx.Err().
+func (client *Client) FetchDetails(ctx context.Context, papers []Paper, opts FetchOptions) ([]*FetchResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DEFAULT_FETCH_WORKERS
+	}
+	results := make([]*FetchResult, len(papers))
+	jobs := make(chan int)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := client.fetchDetail(ctx, i, papers[i], opts)
+				results[i] = result
+				if opts.Progress != nil {
+					mu.Lock()
+					done++
+					opts.Progress(done, len(papers), result)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range papers {
+		if ctx.Err() == nil {
+			// while the workers are busy, a cancellation may come
+			select {
+			case jobs <- i:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		results[i] = &FetchResult{Index: i, Paper: papers[i], AbstractErr: ctx.Err()}
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := []*FetchResult{}
+	for _, result := range results {
+		if result.Err() != nil {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		return results, &FetchError{Failed: failed, Total: len(papers)}
+	}
+	return results, nil
+}
+
+func (client *Client) fetchDetail(ctx context.Context, i int, p Paper, opts FetchOptions) *FetchResult {
+	result := &FetchResult{Index: i, Paper: p}
+	if opts.Abstract {
+		result.AbstractErr = withTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+			return p.SetAbstractFromADSContext(ctx)
+		})
+	}
+	if opts.BibTex {
+		result.BibTexErr = withTimeout(ctx, opts.Timeout, func(ctx context.Context) (err error) {
+			result.BibTex, err = p.GetBibTexContext(ctx)
+			return err
+		})
+	}
+	return result
+}
+
+// withTimeout runs f under ctx, limited to timeout if it is positive.
+func withTimeout(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
+
+func FetchDetails(ctx context.Context, papers []Paper, opts FetchOptions) ([]*FetchResult, error) {
+	return DefaultClient.FetchDetails(ctx, papers, opts)
+}
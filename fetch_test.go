@@ -0,0 +1,159 @@
+package termads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// abstractServer serves the abstract fixture for every bibcode but those
+// in missing, calling hold on each request first.
+func abstractServer(t *testing.T, hold func(r *http.Request), missing ...string) (*httptest.Server, *int32) {
+	t.Helper()
+	page, err := ioutil.ReadFile(filepath.Join(`testdata`, `abstract_1998ApJ_498_541K.html`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		hold(r)
+		for _, bibcode := range missing {
+			if strings.HasSuffix(r.URL.Path, `/`+bibcode) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		w.Header().Set(`Content-Type`, `text/html`)
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+	return server, count
+}
+
+func abstractPapers(client *Client, server *httptest.Server, n int) []Paper {
+	papers := make([]Paper, n)
+	for i := range papers {
+		papers[i] = client.NewPaper()
+		papers[i].SetBibcode(fmt.Sprintf(`2020ApJ...%03d....1A`, i))
+		papers[i].SetURL(server.URL+`/abs/`+papers[i].GetBibcode(), LINKTYPE_ABSTRACT)
+	}
+	return papers
+}
+
+func TestFetchDetails(t *testing.T) {
+	var running, peak int32
+	hold := func(r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&peak)
+			if n <= max || atomic.CompareAndSwapInt32(&peak, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	server, count := abstractServer(t, hold, `2020ApJ...002....1A`, `2020ApJ...007....1A`)
+	client := NewClient()
+	client.Limiter = nil
+	client.Retry = nil
+	papers := abstractPapers(client, server, 10)
+
+	var mu sync.Mutex
+	progress := []int{}
+	results, err := client.FetchDetails(context.Background(), papers, FetchOptions{
+		Abstract: true,
+		Workers:  3,
+		Progress: func(done, total int, result *FetchResult) {
+			mu.Lock()
+			progress = append(progress, done)
+			mu.Unlock()
+			if total != 10 {
+				t.Errorf(`Progress total = %d`, total)
+			}
+		},
+	})
+
+	if peak > 3 || peak < 2 {
+		t.Errorf(`%d requests at once, want at most 3 workers`, peak)
+	}
+	if *count != 10 {
+		t.Errorf(`%d requests, want one per paper`, *count)
+	}
+	if len(progress) != 10 || progress[9] != 10 {
+		t.Errorf(`progress = %v`, progress)
+	}
+
+	// the failures are reported, the other papers are done
+	var ferr *FetchError
+	if !errors.As(err, &ferr) || ferr.Total != 10 || len(ferr.Failed) != 2 || !errors.Is(err, ErrNotFound) {
+		t.Fatalf(`err = %v, want a FetchError of 2 papers`, err)
+	}
+	if !strings.HasPrefix(err.Error(), `2 of 10 papers failed, first 2020ApJ...002....1A: `) {
+		t.Errorf(`err = %v`, err)
+	}
+	for i, result := range results {
+		failed := i == 2 || i == 7
+		if result.Index != i || result.Paper != papers[i] || (result.Err() != nil) != failed {
+			t.Errorf(`result %d = %+v`, i, result)
+		}
+		if got := papers[i].GetAbstract(); failed != (got == ``) {
+			t.Errorf(`abstract %d = %q`, i, got)
+		}
+	}
+	if ferr.Failed[0] != results[2] || ferr.Failed[1] != results[7] {
+		t.Errorf(`failed = %v, want results 2 and 7`, ferr.Failed)
+	}
+}
+
+func TestFetchDetailsCancel(t *testing.T) {
+	started := make(chan bool, 10)
+	// requests last until they are cancelled
+	server, count := abstractServer(t, func(r *http.Request) {
+		started <- true
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	client := NewClient()
+	client.Limiter = nil
+	client.Retry = nil
+	papers := abstractPapers(client, server, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	results, err := client.FetchDetails(ctx, papers, FetchOptions{Abstract: true, Workers: 1})
+	var ferr *FetchError
+	if !errors.As(err, &ferr) || len(ferr.Failed) != 5 || !errors.Is(err, context.Canceled) {
+		t.Fatalf(`err = %v, want all papers cancelled`, err)
+	}
+	// the first paper is sent, the rest never start
+	if n := atomic.LoadInt32(count); n > 2 {
+		t.Errorf(`%d requests after the cancellation`, n)
+	}
+	for i, result := range results[1:] {
+		if !errors.Is(result.AbstractErr, context.Canceled) {
+			t.Errorf(`result %d: %v`, i+1, result.AbstractErr)
+		}
+	}
+
+	// each request has its own timeout
+	results, err = client.FetchDetails(context.Background(), papers[:2], FetchOptions{Abstract: true, Timeout: 20 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) || len(results) != 2 || results[1].Err() == nil {
+		t.Errorf(`with a timeout: err = %v`, err)
+	}
+}
@@ -1,7 +1,14 @@
 package termads
 
+import (
+	"strings"
+)
+
 type Filter struct {
 	linktypes string
+	fromYear  int
+	toYear    int
+	journals  []string
 }
 
 func NewFilter() *Filter {
@@ -12,3 +19,39 @@ func (filter *Filter) Set(linktypes string) {
 	filter.linktypes = linktypes
 	return
 }
+
+// SetYears restricts papers to years from..to. Zero leaves a bound open.
+func (filter *Filter) SetYears(from, to int) {
+	filter.fromYear = from
+	filter.toYear = to
+}
+
+// SetJournals restricts papers to the given bibcode journal abbreviations.
+func (filter *Filter) SetJournals(journals ...string) {
+	filter.journals = journals
+}
+
+// Match reports whether the bibcode of paper satisfies the year and
+// journal restrictions. Papers with a malformed bibcode never match a
+// restricted filter.
+func (filter *Filter) Match(paper Paper) bool {
+	if filter.fromYear == 0 && filter.toYear == 0 && len(filter.journals) == 0 {
+		return true
+	}
+	b, err := ParseBibcode(paper.GetBibcode())
+	if err != nil {
+		return false
+	}
+	if (filter.fromYear > 0 && b.Year < filter.fromYear) || (filter.toYear > 0 && b.Year > filter.toYear) {
+		return false
+	}
+	if len(filter.journals) == 0 {
+		return true
+	}
+	for _, journal := range filter.journals {
+		if strings.EqualFold(strings.Trim(journal, `.`), b.Journal) {
+			return true
+		}
+	}
+	return false
+}
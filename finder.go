@@ -1,8 +1,21 @@
 package termads
 
+import (
+	"sort"
+)
+
+const (
+	SORT_BY_BIBCODE = `bibcode`
+	SORT_BY_YEAR    = `year`
+	SORT_BY_JOURNAL = `journal`
+)
+
 func Find(papers []Paper, filter *Filter) [][4]string {
 	result := make([][4]string, 0, len(papers))
 	for _, paper := range papers {
+		if !filter.Match(paper) {
+			continue
+		}
 		linktypes := paper.LinkTypesIn(filter.linktypes)
 		if linktypes != "" {
 			result = append(result, [4]string{paper.GetAuthors(), paper.GetTitle(), paper.GetBibcode(), linktypes})
@@ -10,3 +23,22 @@ func Find(papers []Paper, filter *Filter) [][4]string {
 	}
 	return result
 }
+
+// SortPapers sorts papers in place by the year or journal encoded in
+// their bibcodes, or by the bibcode itself. Ties keep their order.
+func SortPapers(papers []Paper, key string) {
+	bibcodes := make(map[Paper]Bibcode, len(papers))
+	for _, paper := range papers {
+		bibcodes[paper], _ = ParseBibcode(paper.GetBibcode())
+	}
+	sort.SliceStable(papers, func(i, j int) bool {
+		a, b := bibcodes[papers[i]], bibcodes[papers[j]]
+		switch key {
+		case SORT_BY_YEAR:
+			return a.Year < b.Year
+		case SORT_BY_JOURNAL:
+			return a.Journal < b.Journal
+		}
+		return papers[i].GetBibcode() < papers[j].GetBibcode()
+	})
+}
@@ -3,12 +3,14 @@ package termads
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 )
 
 // ADSform
 type Form struct {
 	keys   []string
 	values url.Values
+	query  Query
 }
 
 func NewForm() *Form {
@@ -98,7 +100,7 @@ func (form *Form) Add(key string, val string) error {
 		form.values.Add(key, val)
 		return nil
 	} else {
-		return fmt.Errorf(`Fail to add value`)
+		return &FieldError{Field: `form key`, Value: key, Reason: `not a field of the search form`}
 	}
 }
 
@@ -137,7 +139,7 @@ func (form *Form) Set(key string, val string) error {
 		form.values.Set(key, val)
 		return nil
 	} else {
-		return fmt.Errorf(`Fail to set value`)
+		return &FieldError{Field: `form key`, Value: key, Reason: `not a field of the search form`}
 	}
 }
 
@@ -171,6 +173,32 @@ func (form *Form) SetText(val string) error {
 	return form.Set(`text`, val)
 }
 
+// SetPage selects the window of results returned by one request. start
+// is 1-based.
+func (form *Form) SetPage(start int, rows int) error {
+	if start < 1 || rows < 1 {
+		return &FieldError{Field: `page`, Value: fmt.Sprintf(`%d,%d`, start, rows), Reason: `start and rows must be positive`}
+	}
+	form.Set(`start_nr`, strconv.Itoa(start))
+	form.Set(`nr_to_return`, strconv.Itoa(rows))
+	return nil
+}
+
+func (form *Form) Page() (start int, rows int) {
+	start, _ = strconv.Atoi(form.values.Get(`start_nr`))
+	rows, _ = strconv.Atoi(form.values.Get(`nr_to_return`))
+	return start, rows
+}
+
+// Copy returns a deep copy of the form.
+func (form *Form) Copy() *Form {
+	values := url.Values{}
+	for key, vals := range form.values {
+		values[key] = append([]string{}, vals...)
+	}
+	return &Form{keys: form.keys, values: values, query: form.query}
+}
+
 func (form *Form) SetSearchLogic(key string, method string) error {
 	if method == `AND` || method == `OR` {
 		switch key {
@@ -193,9 +221,9 @@ func (form *Form) SetSearchLogic(key string, method string) error {
 			form.Set(`obj_logic`, method)
 			return nil
 		default:
-			return fmt.Errorf(`key must be "author", "title", "text", "object" or "all"`)
+			return &FieldError{Field: `search logic key`, Value: key, Reason: `must be "author", "title", "text", "object" or "all"`}
 		}
 	} else {
-		return fmt.Errorf(`method must be "AND" or "OR"`)
+		return &FieldError{Field: `search logic`, Value: method, Reason: `must be "AND" or "OR"`}
 	}
 }
@@ -0,0 +1,45 @@
+package termads
+
+/*=======================================================
+/*              Golden files of the scraper
+/*=======================================================*/
+
+// Golden is what the scraper made of a page saved under testdata, as
+// written by cmd/ads_fixture and compared by the tests.
+type Golden struct {
+	Total    *int          `json:"total,omitempty"`
+	Papers   []GoldenPaper `json:"papers,omitempty"`
+	Abstract string        `json:"abstract,omitempty"`
+	BibTex   string        `json:"bibtex,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type GoldenPaper struct {
+	Bibcode string            `json:"bibcode"`
+	Title   string            `json:"title"`
+	Authors string            `json:"authors"`
+	Score   float64           `json:"score"`
+	Year    int               `json:"year"`
+	Month   int               `json:"month"`
+	Links   map[string]string `json:"links"`
+}
+
+func NewGoldenPaper(p Paper) GoldenPaper {
+	if p == nil {
+		return GoldenPaper{}
+	}
+	meta := p.Metadata()
+	links := map[string]string{}
+	for _, linktype := range p.LinkTypes() {
+		links[string(linktype)] = p.GetURLOfType(string(linktype))
+	}
+	return GoldenPaper{
+		Bibcode: p.GetBibcode(),
+		Title:   p.GetTitle(),
+		Authors: p.GetAuthors(),
+		Score:   meta.Score,
+		Year:    meta.Year,
+		Month:   meta.Month,
+		Links:   links,
+	}
+}
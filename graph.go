@@ -0,0 +1,182 @@
+package termads
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+)
+
+/*=======================================================
+/*           Citations and references
+/*=======================================================*/
+
+// GetLinkedPapers returns the papers citing p (LINKTYPE_CITATIONS) or
+// cited by p (LINKTYPE_REFERENCES). With a token it searches the API for
+// citations(bibcode:...) or references(bibcode:...), up to
+// DEFAULT_RESULT_LIMIT papers; otherwise it reads the list behind the
+// link of the classic interface.
+func (client *Client) GetLinkedPapers(p Paper, linktype string) ([]Paper, error) {
+	return client.GetLinkedPapersContext(context.Background(), p, linktype)
+}
+
+func (client *Client) GetLinkedPapersContext(ctx context.Context, p Paper, linktype string) ([]Paper, error) {
+	var operator func(Query) Query
+	switch linktype {
+	case LINKTYPE_CITATIONS:
+		operator = CitationsOf
+	case LINKTYPE_REFERENCES:
+		operator = ReferencesOf
+	default:
+		return nil, &FieldError{Field: `linktype`, Value: linktype, Reason: `must be ` + LINKTYPE_CITATIONS + ` or ` + LINKTYPE_REFERENCES}
+	}
+	if client.Token != `` {
+		form := NewForm()
+		form.SetAPIQuery(operator(Field(`bibcode`, p.GetBibcode())))
+		return client.SearchContext(ctx, form).All()
+	}
+
+	// ADS leaves the link out when the list is empty
+	if !p.HasLink(linktype) {
+		return []Paper{}, nil
+	}
+	_url := p.GetURLOfType(linktype)
+	body, status, store, err := client.cached(CACHE_SEARCH, _url, func() (*http.Response, error) {
+		return client.get(ctx, _url)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, &StatusError{Code: status}
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	papers, err := client.GetPapersFromDocument(doc)
+	if err == nil {
+		store()
+	}
+	return papers, err
+}
+
+func GetLinkedPapers(p Paper, linktype string) ([]Paper, error) {
+	return DefaultClient.GetLinkedPapers(p, linktype)
+}
+
+func GetLinkedPapersContext(ctx context.Context, p Paper, linktype string) ([]Paper, error) {
+	return DefaultClient.GetLinkedPapersContext(ctx, p, linktype)
+}
+
+/*=======================================================
+/*           Walking the citation graph
+/*=======================================================*/
+
+const DEFAULT_GRAPH_DEPTH int = 1
+
+type GraphOptions struct {
+	Citations  bool // follow the papers citing each paper
+	References bool // follow the papers each paper cites
+	MaxDepth   int  // levels away from the root (default DEFAULT_GRAPH_DEPTH)
+	MaxPapers  int  // stop adding papers after this many; 0 for no limit
+	// Progress is called after the links of each paper are fetched.
+	Progress func(node *GraphNode, found int)
+}
+
+// GraphNode is a paper reached from the root. Each paper appears once,
+// at the depth it was first reached.
+type GraphNode struct {
+	Paper  Paper
+	Depth  int        // 0 for the root
+	Parent *GraphNode // the paper it was first reached from; nil for the root
+	Via    string     // LINKTYPE_CITATIONS if it cites Parent, LINKTYPE_REFERENCES if Parent cites it
+	Links  int        // papers of the graph it was reached from
+	Err    error      // error fetching its own citations or references
+}
+
+// GraphError reports the papers whose links could not be fetched. Their
+// neighbours are missing from the graph.
+type GraphError struct {
+	Failed []*GraphNode
+	Total  int // papers expanded
+}
+
+func (e *GraphError) Error() string {
+	return fmt.Sprintf(`links of %d of %d papers could not be fetched, first %s: %v`,
+		len(e.Failed), e.Total, e.Failed[0].Paper.GetBibcode(), e.Failed[0].Err)
+}
+
+func (e *GraphError) Unwrap() error {
+	return e.Failed[0].Err
+}
+
+// WalkGraph visits the citation graph around root breadth first and
+// returns the papers in the order they were reached, root first. Papers
+// are told apart by bibcode. A paper that cannot be expanded does not
+// stop the walk; it is reported by a *GraphError. If ctx is cancelled the
+// graph so far is returned with ctx.Err().
+func (client *Client) WalkGraph(ctx context.Context, root Paper, opts GraphOptions) ([]*GraphNode, error) {
+	depth := opts.MaxDepth
+	if depth <= 0 {
+		depth = DEFAULT_GRAPH_DEPTH
+	}
+	linktypes := []string{}
+	if opts.Citations {
+		linktypes = append(linktypes, LINKTYPE_CITATIONS)
+	}
+	if opts.References {
+		linktypes = append(linktypes, LINKTYPE_REFERENCES)
+	}
+
+	nodes := []*GraphNode{{Paper: root}}
+	seen := map[string]*GraphNode{root.GetBibcode(): nodes[0]}
+	failed := []*GraphNode{}
+	expanded := 0
+	full := func() bool {
+		return opts.MaxPapers > 0 && len(nodes) >= opts.MaxPapers
+	}
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if node.Depth >= depth {
+			break
+		}
+		expanded++
+		for _, linktype := range linktypes {
+			papers, err := client.GetLinkedPapersContext(ctx, node.Paper, linktype)
+			if ctx.Err() != nil {
+				return nodes, ctx.Err()
+			}
+			if err != nil && node.Err == nil {
+				node.Err = err
+			}
+			for _, p := range papers {
+				if other, ok := seen[p.GetBibcode()]; ok {
+					other.Links++
+					continue
+				}
+				if full() {
+					continue
+				}
+				child := &GraphNode{Paper: p, Depth: node.Depth + 1, Parent: node, Via: linktype, Links: 1}
+				seen[p.GetBibcode()] = child
+				nodes = append(nodes, child)
+			}
+		}
+		if node.Err != nil {
+			failed = append(failed, node)
+		}
+		if opts.Progress != nil {
+			opts.Progress(node, len(nodes))
+		}
+	}
+	if len(failed) > 0 {
+		return nodes, &GraphError{Failed: failed, Total: expanded}
+	}
+	return nodes, nil
+}
+
+func WalkGraph(ctx context.Context, root Paper, opts GraphOptions) ([]*GraphNode, error) {
+	return DefaultClient.WalkGraph(ctx, root, opts)
+}
@@ -0,0 +1,346 @@
+package termads
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*=======================================================
+/*              Full-text index of the library
+/*=======================================================*/
+
+const (
+	INDEX_FILE = `index.json`
+	// BM25 parameters: term frequency saturation and length normalisation
+	BM25_K1 = 1.2
+	BM25_B  = 0.75
+	// words around the best match shown in a snippet
+	SNIPPET_WORDS = 24
+)
+
+var stopWords = map[string]bool{
+	`a`: true, `an`: true, `and`: true, `are`: true, `as`: true, `at`: true, `be`: true, `by`: true,
+	`for`: true, `from`: true, `in`: true, `is`: true, `it`: true, `of`: true, `on`: true, `or`: true,
+	`that`: true, `the`: true, `this`: true, `to`: true, `we`: true, `with`: true,
+}
+
+// IndexDoc is the text of a library entry: its title, abstract and the
+// text of its PDF.
+type IndexDoc struct {
+	Bibcode string `json:"bibcode"`
+	Text    string `json:"text"`
+	Stamp   string `json:"stamp"` // changes with what the text was made from
+	HasPDF  bool   `json:"pdf"`
+}
+
+// Index is an inverted index over the library, searched with BM25. Only
+// the texts are stored in Path; the postings are rebuilt when it is
+// opened.
+type Index struct {
+	Path string
+	Docs []*IndexDoc
+
+	postings  map[string][]posting
+	lengths   []int
+	avgLength float64
+}
+
+type posting struct {
+	doc  int
+	freq int
+}
+
+// SearchHit is a document matching a search, best first.
+type SearchHit struct {
+	Bibcode string
+	Score   float64
+	Snippet Snippet
+}
+
+// Snippet is a piece of the text around the matches. Matches are the
+// byte ranges of the matching words in Text.
+type Snippet struct {
+	Text    string
+	Matches [][2]int
+}
+
+// IndexError reports the entries whose PDF could not be read, by
+// bibcode. They are indexed by title and abstract only.
+type IndexError struct {
+	Failed map[string]error
+	Total  int
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf(`%d of %d PDFs could not be read`, len(e.Failed), e.Total)
+}
+
+func DefaultIndexPath() string {
+	return filepath.Join(DefaultDataDir(), INDEX_FILE)
+}
+
+// OpenIndex reads the index at path. A missing file is an empty index.
+func OpenIndex(path string) (*Index, error) {
+	index := &Index{Path: path, Docs: []*IndexDoc{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		index.build()
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index.Docs); err != nil {
+		return nil, &ParseError{What: path, Msg: err.Error()}
+	}
+	index.build()
+	return index, nil
+}
+
+func (index *Index) Save() error {
+	if err := os.MkdirAll(filepath.Dir(index.Path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(index.Docs)
+	if err != nil {
+		return err
+	}
+	return replaceFile(index.Path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Update brings the index in line with lib: entries that are new or whose
+// abstract or PDF changed are indexed again, removed ones are dropped. It
+// works offline. It returns the number of entries indexed; PDFs that
+// cannot be read are reported by an *IndexError.
+func (index *Index) Update(lib *Library) (int, error) {
+	old := map[string]*IndexDoc{}
+	for _, doc := range index.Docs {
+		old[doc.Bibcode] = doc
+	}
+	docs := make([]*IndexDoc, 0, len(lib.Entries))
+	failed := map[string]error{}
+	pdfs, indexed := 0, 0
+	for _, entry := range lib.Entries {
+		if entry.PDF != `` {
+			pdfs++
+		}
+		stamp := entryStamp(entry)
+		if doc := old[entry.Bibcode]; doc != nil && doc.Stamp == stamp {
+			docs = append(docs, doc)
+			continue
+		}
+		doc := &IndexDoc{Bibcode: entry.Bibcode, Stamp: stamp}
+		doc.Text = PlainText(entry.Title) + "\n" + PlainText(entry.Abstract)
+		if entry.PDF != `` {
+			text, err := ExtractPDFText(entry.PDF)
+			if err != nil {
+				failed[entry.Bibcode] = err
+				// tried again next time
+				doc.Stamp = ``
+			} else {
+				doc.Text += "\n" + text
+				doc.HasPDF = true
+			}
+		}
+		docs = append(docs, doc)
+		indexed++
+	}
+	index.Docs = docs
+	index.build()
+	if len(failed) > 0 {
+		return indexed, &IndexError{Failed: failed, Total: pdfs}
+	}
+	return indexed, nil
+}
+
+// entryStamp sums up what the text of entry is made from.
+func entryStamp(entry *LibraryEntry) string {
+	h := fnv.New64a()
+	// of the text indexed, so entries indexed with their HTML are redone
+	io.WriteString(h, PlainText(entry.Title)+"\x00"+PlainText(entry.Abstract)+"\x00"+entry.PDF)
+	if info, err := os.Stat(entry.PDF); entry.PDF != `` && err == nil {
+		fmt.Fprintf(h, "\x00%d\x00%d", info.Size(), info.ModTime().UnixNano())
+	}
+	return fmt.Sprintf(`%x`, h.Sum64())
+}
+
+func (index *Index) build() {
+	index.postings = map[string][]posting{}
+	index.lengths = make([]int, len(index.Docs))
+	total := 0
+	for i, doc := range index.Docs {
+		freqs := map[string]int{}
+		for _, t := range words(doc.Text) {
+			freqs[t.term]++
+			index.lengths[i]++
+		}
+		for term, freq := range freqs {
+			index.postings[term] = append(index.postings[term], posting{doc: i, freq: freq})
+		}
+		total += index.lengths[i]
+	}
+	index.avgLength = 1
+	if total > 0 {
+		index.avgLength = float64(total) / float64(len(index.Docs))
+	}
+}
+
+// Search ranks the documents containing any word of query by BM25 and
+// returns at most limit of them (all if limit is 0) with a snippet.
+func (index *Index) Search(query string, limit int) []SearchHit {
+	terms := map[string]bool{}
+	for _, t := range words(query) {
+		terms[t.term] = true
+	}
+	scores := map[int]float64{}
+	n := float64(len(index.Docs))
+	for term := range terms {
+		postings := index.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.freq)
+			norm := 1 - BM25_B + BM25_B*float64(index.lengths[p.doc])/index.avgLength
+			scores[p.doc] += idf * tf * (BM25_K1 + 1) / (tf + BM25_K1*norm)
+		}
+	}
+	docs := make([]int, 0, len(scores))
+	for doc := range scores {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if scores[docs[i]] != scores[docs[j]] {
+			return scores[docs[i]] > scores[docs[j]]
+		}
+		return docs[i] < docs[j]
+	})
+	if limit > 0 && len(docs) > limit {
+		docs = docs[:limit]
+	}
+	hits := make([]SearchHit, len(docs))
+	for i, doc := range docs {
+		hits[i] = SearchHit{
+			Bibcode: index.Docs[doc].Bibcode,
+			Score:   scores[doc],
+			Snippet: makeSnippet(index.Docs[doc].Text, terms),
+		}
+	}
+	return hits
+}
+
+// makeSnippet picks the SNIPPET_WORDS words of text with the most
+// distinct query terms, preferring the earliest.
+func makeSnippet(text string, terms map[string]bool) Snippet {
+	tokens := words(text)
+	if len(tokens) == 0 {
+		return Snippet{}
+	}
+	best, bestCount := 0, -1
+	for i := range tokens {
+		if !terms[tokens[i].term] {
+			continue
+		}
+		// start a little before the match
+		start := i - SNIPPET_WORDS/4
+		if start < 0 {
+			start = 0
+		}
+		seen := map[string]bool{}
+		for j := start; j < start+SNIPPET_WORDS && j < len(tokens); j++ {
+			if terms[tokens[j].term] {
+				seen[tokens[j].term] = true
+			}
+		}
+		if len(seen) > bestCount {
+			best, bestCount = start, len(seen)
+		}
+	}
+	end := best + SNIPPET_WORDS
+	if end > len(tokens) {
+		end = len(tokens)
+	}
+	text = strings.Join(strings.Fields(text[tokens[best].start:tokens[end-1].end]), ` `)
+	if best > 0 {
+		text = `...` + text
+	}
+	if end < len(tokens) {
+		text += `...`
+	}
+	snippet := Snippet{Text: text}
+	for _, t := range words(text) {
+		if terms[t.term] {
+			snippet.Matches = append(snippet.Matches, [2]int{t.start, t.end})
+		}
+	}
+	return snippet
+}
+
+// Mark returns the text with the matches between open and close, e.g.
+// terminal escapes.
+func (s Snippet) Mark(open, close string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range s.Matches {
+		b.WriteString(s.Text[last:m[0]])
+		b.WriteString(open + s.Text[m[0]:m[1]] + close)
+		last = m[1]
+	}
+	b.WriteString(s.Text[last:])
+	return b.String()
+}
+
+type word struct {
+	term       string
+	start, end int // byte offsets in the text
+}
+
+// words splits text into lower-case words of letters and digits,
+// leaving out stop words. Plurals are folded to the singular so that
+// "galaxies" finds "galaxy".
+func words(text string) []word {
+	tokens := []word{}
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		w := strings.ToLower(text[start:end])
+		if !stopWords[w] {
+			tokens = append(tokens, word{term: stem(w), start: start, end: end})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return tokens
+}
+
+func stem(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, `ies`):
+		return word[:len(word)-3] + `y`
+	case len(word) > 3 && strings.HasSuffix(word, `s`) && !strings.HasSuffix(word, `ss`) && !strings.HasSuffix(word, `us`):
+		return word[:len(word)-1]
+	}
+	return word
+}
@@ -0,0 +1,35 @@
+package termads
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexPlainText(t *testing.T) {
+	dir := t.TempDir()
+	lib := &Library{Path: filepath.Join(dir, LIBRARY_FILE), Entries: []*LibraryEntry{{
+		Bibcode:  `2012ARA&A..50..531K`,
+		Title:    `Star Formation in the Milky Way and Nearby Galaxies`,
+		Abstract: `We review the H<SUB>2</SUB> surface density &amp; the star formation rate.<P />The Schmidt law holds.`,
+	}}}
+	index, err := OpenIndex(filepath.Join(dir, INDEX_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.Update(lib); err != nil {
+		t.Fatal(err)
+	}
+	for _, markup := range []string{`sub`, `amp`} {
+		if hits := index.Search(markup, 0); len(hits) != 0 {
+			t.Errorf(`%q is indexed from the markup`, markup)
+		}
+	}
+	hits := index.Search(`surface density`, 0)
+	if len(hits) != 1 {
+		t.Fatalf(`got %d hits, want 1`, len(hits))
+	}
+	if snippet := hits[0].Snippet.Text; strings.ContainsAny(snippet, `<>;`) || !strings.Contains(snippet, `H2 surface density & the`) {
+		t.Errorf(`snippet = %q`, snippet)
+	}
+}
@@ -0,0 +1,116 @@
+package termads
+
+import (
+	"strings"
+)
+
+// AASTeX macros used by ADS for journal names, keyed by bibstem.
+var journalMacros = map[string]string{
+	`AJ`:    `\aj`,
+	`ARA&A`: `\araa`,
+	`ApJ`:   `\apj`,
+	`ApJL`:  `\apjl`,
+	`ApJS`:  `\apjs`,
+	`ApOpt`: `\ao`,
+	`Ap&SS`: `\apss`,
+	`A&A`:   `\aap`,
+	`A&ARv`: `\aapr`,
+	`A&AS`:  `\aaps`,
+	`AZh`:   `\azh`,
+	`BAAS`:  `\baas`,
+	`JRASC`: `\jrasc`,
+	`MmRAS`: `\memras`,
+	`MNRAS`: `\mnras`,
+	`PhRvA`: `\pra`,
+	`PhRvB`: `\prb`,
+	`PhRvC`: `\prc`,
+	`PhRvD`: `\prd`,
+	`PhRvE`: `\pre`,
+	`PhRvL`: `\prl`,
+	`PASA`:  `\pasa`,
+	`PASP`:  `\pasp`,
+	`PASJ`:  `\pasj`,
+	`QJRAS`: `\qjras`,
+	`S&T`:   `\skytel`,
+	`SoPh`:  `\solphys`,
+	`SvA`:   `\sovast`,
+	`SSRv`:  `\ssr`,
+	`ZA`:    `\zap`,
+	`Natur`: `\nat`,
+	`IAUC`:  `\iaucirc`,
+	`ApL`:   `\aplett`,
+	`ApLC`:  `\apspr`,
+	`BAICz`: `\bac`,
+	`CeMDA`: `\caa`,
+	`FCPh`:  `\fcp`,
+	`GeCoA`: `\gca`,
+	`GeoRL`: `\grl`,
+	`JCAP`:  `\jcap`,
+	`JChPh`: `\jcp`,
+	`JGR`:   `\jgr`,
+	`JQSRT`: `\jqsrt`,
+	`NuPhA`: `\nphysa`,
+	`PhR`:   `\physrep`,
+	`PhyS`:  `\physscr`,
+	`Icar`:  `\icarus`,
+	`PSS`:   `\planss`,
+	`SPIE`:  `\procspie`,
+}
+
+// Journal names of the most common macros.
+var journalNames = map[string]string{
+	`\aj`:       `Astronomical Journal`,
+	`\araa`:     `Annual Review of Astronomy and Astrophysics`,
+	`\apj`:      `Astrophysical Journal`,
+	`\apjl`:     `Astrophysical Journal Letters`,
+	`\apjs`:     `Astrophysical Journal Supplement Series`,
+	`\apss`:     `Astrophysics and Space Science`,
+	`\aap`:      `Astronomy and Astrophysics`,
+	`\aapr`:     `Astronomy and Astrophysics Review`,
+	`\aaps`:     `Astronomy and Astrophysics Supplement Series`,
+	`\baas`:     `Bulletin of the American Astronomical Society`,
+	`\mnras`:    `Monthly Notices of the Royal Astronomical Society`,
+	`\pasa`:     `Publications of the Astronomical Society of Australia`,
+	`\pasp`:     `Publications of the Astronomical Society of the Pacific`,
+	`\pasj`:     `Publications of the Astronomical Society of Japan`,
+	`\prd`:      `Physical Review D`,
+	`\prl`:      `Physical Review Letters`,
+	`\nat`:      `Nature`,
+	`\icarus`:   `Icarus`,
+	`\ssr`:      `Space Science Reviews`,
+	`\solphys`:  `Solar Physics`,
+	`\jcap`:     `Journal of Cosmology and Astroparticle Physics`,
+	`\physrep`:  `Physics Reports`,
+	`\planss`:   `Planetary and Space Science`,
+	`\procspie`: `Proceedings of the SPIE`,
+}
+
+// JournalMacro returns the AASTeX macro of a bibstem, e.g. "\apj" for
+// "ApJ", or the bibstem itself if there is none. Letters to ApJ
+// (qualifier "L") map to \apjl.
+func JournalMacro(bibstem string, qualifier string) string {
+	if bibstem == `ApJ` && qualifier == `L` {
+		bibstem = `ApJL`
+	}
+	if macro, ok := journalMacros[bibstem]; ok {
+		return macro
+	}
+	return bibstem
+}
+
+// JournalFromMacro is the inverse of JournalMacro.
+func JournalFromMacro(macro string) (string, bool) {
+	macro = strings.TrimSpace(macro)
+	for bibstem, m := range journalMacros {
+		if m == macro {
+			return bibstem, true
+		}
+	}
+	return ``, false
+}
+
+// JournalName returns the full name of a journal macro such as \apj.
+func JournalName(macro string) (string, bool) {
+	name, ok := journalNames[strings.TrimSpace(macro)]
+	return name, ok
+}
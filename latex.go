@@ -0,0 +1,260 @@
+package termads
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*=======================================================
+/*                 LaTeX citation scanner
+/*=======================================================*/
+
+type Citation struct {
+	Key  string
+	File string
+	Line int
+}
+
+// LaTeXProject is the result of ScanLaTeX.
+type LaTeXProject struct {
+	Root           string   // directory of the main file
+	Files          []string // .tex files in the order they were read
+	Citations      []Citation
+	Bibliographies []string // .bib files named in \bibliography or \addbibresource
+}
+
+var (
+	latexCommentPattern = regexp.MustCompile(`(^|[^\\])%.*`)
+	latexInputPattern   = regexp.MustCompile(`\\(?:input|include|subfile)\s*\{([^}]+)\}`)
+	latexCitePattern    = regexp.MustCompile(`\\(?:[A-Za-z]*cite[A-Za-z]*)\*?\s*(?:\[[^\]]*\]\s*){0,2}\{([^}]*)\}`)
+	latexBibPattern     = regexp.MustCompile(`\\(?:bibliography|addbibresource)\s*(?:\[[^\]]*\]\s*)?\{([^}]+)\}`)
+)
+
+// ScanLaTeX reads the main file of a LaTeX project and the files it
+// pulls in with \input, \include or \subfile, and collects the keys of
+// all \cite-like commands (\citep, \citet, \nocite, \parencite...).
+func ScanLaTeX(main string) (*LaTeXProject, error) {
+	project := &LaTeXProject{
+		Root:           filepath.Dir(main),
+		Files:          []string{},
+		Citations:      []Citation{},
+		Bibliographies: []string{},
+	}
+	if err := project.scan(main, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func (project *LaTeXProject) scan(path string, seen map[string]bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if seen[abs] {
+		return nil
+	}
+	seen[abs] = true
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	project.Files = append(project.Files, path)
+
+	// Comments are blanked out line by line so that offsets keep their
+	// line numbers.
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		lines[i] = latexCommentPattern.ReplaceAllString(line, `$1`)
+	}
+	text := strings.Join(lines, "\n")
+	lineOf := func(offset int) int {
+		return strings.Count(text[:offset], "\n") + 1
+	}
+
+	for _, m := range latexCitePattern.FindAllStringSubmatchIndex(text, -1) {
+		for _, key := range strings.Split(text[m[2]:m[3]], `,`) {
+			key = strings.TrimSpace(key)
+			if key == `` || key == `*` {
+				continue
+			}
+			project.Citations = append(project.Citations, Citation{Key: key, File: path, Line: lineOf(m[0])})
+		}
+	}
+	for _, m := range latexBibPattern.FindAllStringSubmatch(text, -1) {
+		for _, name := range strings.Split(m[1], `,`) {
+			name = strings.TrimSpace(name)
+			if filepath.Ext(name) != `.bib` {
+				name += `.bib`
+			}
+			project.Bibliographies = append(project.Bibliographies, filepath.Join(project.Root, name))
+		}
+	}
+	for _, m := range latexInputPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := strings.TrimSpace(text[m[2]:m[3]])
+		child := filepath.Join(project.Root, name)
+		if _, err := os.Stat(child); err != nil && filepath.Ext(name) != `.tex` {
+			child += `.tex`
+		}
+		if err := project.scan(child, seen); err != nil {
+			return fmt.Errorf(`%s:%d: %v`, path, lineOf(m[0]), err)
+		}
+	}
+	return nil
+}
+
+// Keys returns the cited keys without duplicates, in order of first use.
+func (project *LaTeXProject) Keys() []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, c := range project.Citations {
+		if !seen[c.Key] {
+			seen[c.Key] = true
+			keys = append(keys, c.Key)
+		}
+	}
+	return keys
+}
+
+/*=======================================================
+/*                 Resolving cite keys
+/*=======================================================*/
+
+const (
+	ID_BIBCODE = `bibcode`
+	ID_ARXIV   = `arxiv`
+	ID_DOI     = `doi`
+)
+
+var (
+	arXivIDPattern = regexp.MustCompile(`^(?i:arxiv:)?(\d{4}\.\d{4,5}|[a-z\-]+(?:\.[A-Z]{2})?/\d{7})(?:v\d+)?$`)
+	doiPattern     = regexp.MustCompile(`^(?i:doi:)?(10\.\d{4,9}/\S+)$`)
+)
+
+// ParseIdentifier tells whether a cite key is a bibcode, an arXiv id
+// (with or without the "arXiv:" prefix) or a DOI, and returns the bare
+// identifier. kind is empty for ordinary keys.
+func ParseIdentifier(key string) (kind string, id string) {
+	if len(key) == BIBCODE_LENGTH {
+		if bibcode, err := NormalizeBibcode(key); err == nil {
+			return ID_BIBCODE, bibcode
+		}
+	}
+	if m := arXivIDPattern.FindStringSubmatch(key); m != nil {
+		return ID_ARXIV, m[1]
+	}
+	if m := doiPattern.FindStringSubmatch(key); m != nil {
+		return ID_DOI, m[1]
+	}
+	return ``, ``
+}
+
+// LookupBibcode returns the bibcode of the paper with the given arXiv id
+// or DOI. Without an API token the classic interface cannot search
+// these fields.
+func (client *Client) LookupBibcode(kind, id string) (string, error) {
+	return client.LookupBibcodeContext(context.Background(), kind, id)
+}
+
+func (client *Client) LookupBibcodeContext(ctx context.Context, kind, id string) (string, error) {
+	var q Query
+	switch kind {
+	case ID_BIBCODE:
+		return NormalizeBibcode(id)
+	case ID_ARXIV:
+		q = ArXiv(id)
+	case ID_DOI:
+		q = DOI(id)
+	default:
+		return ``, &FieldError{Field: `identifier type`, Value: kind, Reason: `must be bibcode, arxiv or doi`}
+	}
+	form := NewForm()
+	if client.Token == `` {
+		if err := form.SetQuery(q); err != nil {
+			return ``, fmt.Errorf(`%s %s: an ADS API token is required: %w`, kind, id, err)
+		}
+	} else {
+		form.SetAPIQuery(q)
+	}
+	if err := form.SetPage(1, 1); err != nil {
+		return ``, err
+	}
+	papers, _, err := client.GetPageContext(ctx, form)
+	if err != nil {
+		return ``, err
+	}
+	if len(papers) == 0 || papers[0] == nil {
+		return ``, fmt.Errorf(`%s %s: %w in ADS`, kind, id, ErrNotFound)
+	}
+	return papers[0].GetBibcode(), nil
+}
+
+// ResolveCiteKeys fetches BibTeX for cite keys that are identifiers. The
+// returned entries carry the cite key so the manuscript compiles as is.
+// Keys that cannot be resolved are returned with the reason.
+func (client *Client) ResolveCiteKeys(keys []string) ([]*BibEntry, map[string]error, error) {
+	return client.ResolveCiteKeysContext(context.Background(), keys)
+}
+
+func (client *Client) ResolveCiteKeysContext(ctx context.Context, keys []string) ([]*BibEntry, map[string]error, error) {
+	unresolved := map[string]error{}
+	bibcodes := []string{}
+	keyOf := map[string][]string{}
+	for _, key := range keys {
+		kind, id := ParseIdentifier(key)
+		if kind == `` {
+			unresolved[key] = &FieldError{Field: `cite key`, Value: key, Reason: `not a bibcode, arXiv id or DOI`}
+			continue
+		}
+		bibcode, err := client.LookupBibcodeContext(ctx, kind, id)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			unresolved[key] = err
+			continue
+		}
+		if _, ok := keyOf[bibcode]; !ok {
+			bibcodes = append(bibcodes, bibcode)
+		}
+		keyOf[bibcode] = append(keyOf[bibcode], key)
+	}
+	entries := []*BibEntry{}
+	if len(bibcodes) == 0 {
+		return entries, unresolved, nil
+	}
+	texts, missing, err := client.GetBibTexBatchContext(ctx, bibcodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, bibcode := range missing {
+		for _, key := range keyOf[bibcode] {
+			unresolved[key] = fmt.Errorf(`no BibTeX entry for %s: %w`, bibcode, ErrNotFound)
+		}
+	}
+	for _, bibcode := range bibcodes {
+		text, ok := texts[bibcode]
+		if !ok {
+			continue
+		}
+		for _, key := range keyOf[bibcode] {
+			file, err := ParseBibTex(text)
+			if err != nil || len(file.Entries()) == 0 {
+				if err == nil {
+					err = &ParseError{What: `BibTeX`, Msg: `no entry`, Snippet: snippet(text, 0)}
+				}
+				unresolved[key] = fmt.Errorf(`%s: %w`, bibcode, err)
+				continue
+			}
+			entry := file.Entries()[0]
+			entry.SetKey(key)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, unresolved, nil
+}
@@ -0,0 +1,34 @@
+package termads
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupBibcode(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join(`testdata`, `api_search_kennicutt.json`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		kind, id, q string
+	}{
+		{ID_ARXIV, `astro-ph/9712213`, `arXiv:"astro-ph/9712213"`},
+		{ID_DOI, `10.1086/305588`, `doi:"10.1086/305588"`},
+	}
+	for _, tt := range tests {
+		server, query := apiServer(t, http.StatusOK, body, nil)
+		bibcode, err := apiClient(server).LookupBibcode(tt.kind, tt.id)
+		if err != nil || bibcode != `1998ApJ...498..541K` {
+			t.Errorf(`LookupBibcode(%s, %s) = %q, %v`, tt.kind, tt.id, bibcode, err)
+		}
+		// one row is enough to know the bibcode
+		for key, want := range map[string]string{`q`: tt.q, `rows`: `1`, `start`: ``} {
+			if got := query.Get(key); got != want {
+				t.Errorf(`LookupBibcode(%s, %s): %s = %q, want %q`, tt.kind, tt.id, key, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package termads
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*=======================================================
+/*                 Paper library
+/*=======================================================*/
+
+const LIBRARY_FILE = `library.json`
+
+// LibraryEntry is a paper kept in the library with what the user added
+// to it.
+type LibraryEntry struct {
+	Bibcode  string            `json:"bibcode"`
+	Title    string            `json:"title"`
+	Abstract string            `json:"abstract,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+	Metadata Metadata          `json:"metadata"`
+	PDF      string            `json:"pdf,omitempty"` // path of the downloaded PDF
+	Tags     []string          `json:"tags,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	Read     bool              `json:"read"`
+	Added    time.Time         `json:"added"`
+}
+
+// Library is a list of papers stored as JSON in Path. It is read whole
+// and written back by Save.
+type Library struct {
+	Path    string
+	Entries []*LibraryEntry // in the order they were added
+}
+
+func DefaultLibraryPath() string {
+	return filepath.Join(DefaultDataDir(), LIBRARY_FILE)
+}
+
+// OpenLibrary reads the library at path. A missing file is an empty
+// library.
+func OpenLibrary(path string) (*Library, error) {
+	lib := &Library{Path: path, Entries: []*LibraryEntry{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lib, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &lib.Entries); err != nil {
+		return nil, &ParseError{What: path, Msg: err.Error()}
+	}
+	return lib, nil
+}
+
+// Save writes the library back to its file, keeping the previous
+// version as .bak.
+func (lib *Library) Save() error {
+	if err := os.MkdirAll(filepath.Dir(lib.Path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lib.Entries, ``, "\t")
+	if err != nil {
+		return err
+	}
+	return replaceFile(lib.Path, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// Get returns the entry of bibcode, or nil.
+func (lib *Library) Get(bibcode string) *LibraryEntry {
+	for _, entry := range lib.Entries {
+		if entry.Bibcode == bibcode {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Add stores p, or refreshes the ADS data of its entry if it is there
+// already, keeping the tags, notes and read state. It reports whether p
+// was new.
+func (lib *Library) Add(p Paper) (*LibraryEntry, bool) {
+	entry := lib.Get(p.GetBibcode())
+	added := entry == nil
+	if added {
+		entry = &LibraryEntry{Bibcode: p.GetBibcode(), Added: time.Now()}
+		lib.Entries = append(lib.Entries, entry)
+	}
+	if p.GetTitle() != `` || entry.Title == `` {
+		entry.Title = p.GetTitle()
+		entry.Metadata = *p.Metadata()
+	}
+	if p.GetAbstract() != `` {
+		entry.Abstract = p.GetAbstract()
+	}
+	if entry.Links == nil {
+		entry.Links = map[string]string{}
+	}
+	for _, linktype := range p.LinkTypes() {
+		entry.Links[string(linktype)] = p.GetURLOfType(string(linktype))
+	}
+	return entry, added
+}
+
+// Remove drops the entry of bibcode and reports whether there was one.
+// Its PDF is left on disk.
+func (lib *Library) Remove(bibcode string) bool {
+	for i, entry := range lib.Entries {
+		if entry.Bibcode == bibcode {
+			lib.Entries = append(lib.Entries[:i], lib.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetPDFs records where the PDFs of the papers in the library were
+// downloaded to. Papers that are not in it, and nil downloads, are
+// skipped. It returns the number of entries that changed.
+func (lib *Library) SetPDFs(downloads []*Download) int {
+	changed := 0
+	for _, download := range downloads {
+		if download == nil || download.Paper == nil {
+			continue
+		}
+		entry := lib.Get(download.Paper.GetBibcode())
+		if entry == nil {
+			continue
+		}
+		// the library is used from other directories too
+		path, err := filepath.Abs(download.Path)
+		if err != nil {
+			path = download.Path
+		}
+		if entry.PDF != path {
+			entry.PDF = path
+			changed++
+		}
+	}
+	return changed
+}
+
+// Tags returns all tags in use, sorted.
+func (lib *Library) Tags() []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, entry := range lib.Entries {
+		for _, tag := range entry.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Select returns the entries with tag (any if empty), only the unread
+// ones if unread is set, that match filter (may be nil).
+func (lib *Library) Select(tag string, unread bool, filter *Filter) []*LibraryEntry {
+	entries := []*LibraryEntry{}
+	for _, entry := range lib.Entries {
+		if (tag != `` && !entry.HasTag(tag)) || (unread && entry.Read) {
+			continue
+		}
+		if filter != nil && !filter.Match(entry.Paper()) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (entry *LibraryEntry) HasTag(tag string) bool {
+	for _, t := range entry.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tag adds tags the entry does not have yet.
+func (entry *LibraryEntry) Tag(tags ...string) {
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != `` && !entry.HasTag(tag) {
+			entry.Tags = append(entry.Tags, tag)
+		}
+	}
+}
+
+func (entry *LibraryEntry) Untag(tags ...string) {
+	kept := []string{}
+	for _, t := range entry.Tags {
+		remove := false
+		for _, tag := range tags {
+			remove = remove || strings.EqualFold(t, strings.TrimSpace(tag))
+		}
+		if !remove {
+			kept = append(kept, t)
+		}
+	}
+	entry.Tags = kept
+}
+
+// Paper rebuilds the paper of the entry, using DefaultClient for what is
+// fetched later.
+func (entry *LibraryEntry) Paper() Paper {
+	return entry.PaperOf(DefaultClient)
+}
+
+// PaperOf rebuilds the paper of the entry for client.
+func (entry *LibraryEntry) PaperOf(client *Client) Paper {
+	p := client.NewPaper()
+	p.SetBibcode(entry.Bibcode)
+	p.SetTitle(entry.Title)
+	p.SetAbstract(entry.Abstract)
+	*p.Metadata() = entry.Metadata
+	for linktype, link := range entry.Links {
+		p.SetURL(link, linktype)
+	}
+	return p
+}
+
+// LibraryPapers rebuilds the papers of entries, e.g. to export them.
+func (client *Client) LibraryPapers(entries []*LibraryEntry) []Paper {
+	papers := make([]Paper, len(entries))
+	for i, entry := range entries {
+		papers[i] = entry.PaperOf(client)
+	}
+	return papers
+}
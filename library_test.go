@@ -0,0 +1,34 @@
+package termads
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLibrarySetPDFs(t *testing.T) {
+	dir := t.TempDir()
+	lib, err := OpenLibrary(filepath.Join(dir, LIBRARY_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := NewPaper()
+	kept.SetBibcode(`1998ApJ...498..541K`)
+	lib.Add(kept)
+	other := NewPaper()
+	other.SetBibcode(`2012ARA&A..50..531K`)
+
+	path := filepath.Join(dir, `1998ApJ...498..541K.pdf`)
+	downloads := []*Download{{Paper: kept, Path: path}, {Paper: other, Path: filepath.Join(dir, `other.pdf`)}, nil}
+	if n := lib.SetPDFs(downloads); n != 1 {
+		t.Errorf(`SetPDFs changed %d entries, want 1`, n)
+	}
+	if got := lib.Get(`1998ApJ...498..541K`).PDF; got != path {
+		t.Errorf(`PDF = %q, want %q`, got, path)
+	}
+	if lib.Get(`2012ARA&A..50..531K`) != nil {
+		t.Error(`a paper not in the library was added`)
+	}
+	if n := lib.SetPDFs(downloads); n != 0 {
+		t.Errorf(`SetPDFs changed %d entries again`, n)
+	}
+}
@@ -0,0 +1,184 @@
+package termads
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*=======================================================
+/*                 Paper metadata
+/*=======================================================*/
+
+type Person struct {
+	Name        string // as given by ADS, e.g. "Kennicutt, R. C., Jr."
+	Last        string
+	First       string
+	Suffix      string
+	Affiliation string
+	ORCID       string
+}
+
+// ParseAuthor splits "Last, First[, Suffix]" or "First Last".
+func ParseAuthor(name string) Person {
+	name = strings.TrimSpace(name)
+	author := Person{Name: name}
+	if name == `` {
+		return author
+	}
+	if strings.Contains(name, `,`) {
+		parts := strings.Split(name, `,`)
+		author.Last = strings.TrimSpace(parts[0])
+		author.First = strings.TrimSpace(parts[1])
+		if len(parts) > 2 {
+			author.Suffix = strings.TrimSpace(strings.Join(parts[2:], `,`))
+		}
+		return author
+	}
+	words := strings.Fields(name)
+	author.Last = words[len(words)-1]
+	author.First = strings.Join(words[:len(words)-1], ` `)
+	return author
+}
+
+// ParseAuthors splits the author cell of the classic interface, which
+// separates authors by semicolons.
+func ParseAuthors(s string) []Person {
+	authors := []Person{}
+	for _, name := range strings.Split(s, `;`) {
+		if name = strings.TrimSpace(name); name != `` {
+			authors = append(authors, ParseAuthor(name))
+		}
+	}
+	return authors
+}
+
+func (author Person) String() string {
+	if author.Name != `` {
+		return author.Name
+	}
+	name := author.Last
+	if author.First != `` {
+		name += `, ` + author.First
+	}
+	if author.Suffix != `` {
+		name += `, ` + author.Suffix
+	}
+	return name
+}
+
+// Initials abbreviates the first names, e.g. "Robert C." to "R. C.".
+func (author Person) Initials() string {
+	initials := []string{}
+	for _, name := range strings.Fields(strings.Replace(author.First, `.`, `. `, -1)) {
+		parts := []string{}
+		for _, part := range strings.Split(name, `-`) {
+			if r := []rune(strings.TrimSpace(part)); len(r) > 0 {
+				parts = append(parts, string(r[0])+`.`)
+			}
+		}
+		if len(parts) > 0 {
+			initials = append(initials, strings.Join(parts, `-`))
+		}
+	}
+	return strings.Join(initials, ` `)
+}
+
+// Metadata holds the typed bibliographic data of a paper. Zero values
+// mean "unknown".
+type Metadata struct {
+	Authors       []Person
+	Year          int
+	Month         int
+	Bibstem       string
+	Volume        string
+	Page          string
+	DOI           string
+	ArXivID       string
+	Keywords      []string
+	CitationCount int
+	ReadCount     int
+	Score         float64
+}
+
+// Affiliations returns the distinct affiliations of the authors in order.
+func (meta *Metadata) Affiliations() []string {
+	affs := []string{}
+	seen := map[string]bool{}
+	for _, author := range meta.Authors {
+		if author.Affiliation != `` && author.Affiliation != `-` && !seen[author.Affiliation] {
+			seen[author.Affiliation] = true
+			affs = append(affs, author.Affiliation)
+		}
+	}
+	return affs
+}
+
+// SetPubDate parses ADS dates such as "2019-05-00" or "05/2019".
+func (meta *Metadata) SetPubDate(date string) {
+	date = strings.TrimSpace(date)
+	var year, month string
+	switch {
+	case strings.Contains(date, `-`):
+		parts := strings.Split(date, `-`)
+		year = parts[0]
+		if len(parts) > 1 {
+			month = parts[1]
+		}
+	case strings.Contains(date, `/`):
+		parts := strings.Split(date, `/`)
+		month, year = parts[0], parts[len(parts)-1]
+	default:
+		year = date
+	}
+	if y, err := strconv.Atoi(year); err == nil {
+		meta.Year = y
+	}
+	if m, err := strconv.Atoi(month); err == nil && m >= 1 && m <= 12 {
+		meta.Month = m
+	}
+}
+
+// setFromBibcode fills the fields encoded in the bibcode which are still
+// unknown.
+func (meta *Metadata) setFromBibcode(bibcode string) {
+	b, err := ParseBibcode(bibcode)
+	if err != nil {
+		return
+	}
+	if meta.Year == 0 {
+		meta.Year = b.Year
+	}
+	if meta.Bibstem == `` {
+		meta.Bibstem = b.Journal
+	}
+	if meta.Volume == `` {
+		meta.Volume = b.Volume
+	}
+	if meta.Page == `` {
+		meta.Page = b.Qualifier + b.Page
+	}
+}
+
+var (
+	htmlSup   = regexp.MustCompile(`(?i)<\s*sup\s*>`)
+	htmlBreak = regexp.MustCompile(`(?i)<\s*(br|/?p)\s*/?>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// PlainText strips the HTML of a title or abstract from ADS: tags go,
+// entities are decoded and superscripts are written with ^. Paragraphs
+// are kept as lines.
+func PlainText(s string) string {
+	s = htmlSup.ReplaceAllString(s, `^`)
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, ``))
+	paragraphs := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), ` `); line != `` {
+			paragraphs = append(paragraphs, line)
+		}
+	}
+	return strings.Join(paragraphs, "\n")
+}
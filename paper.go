@@ -1,6 +1,7 @@
 package termads
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
@@ -31,9 +32,33 @@ const (
 	VALID_LINKS                 string = `ACDEFGHILMNOPRSTUXZ`
 )
 
+// LINKTYPE_NAMES are the names ADS gives the link types.
+var LINKTYPE_NAMES = map[string]string{
+	LINKTYPE_ABSTRACT:           `Abstract`,
+	LINKTYPE_CITATIONS:          `Citations to the article`,
+	LINKTYPE_ONLINE_DATA:        `On-line data`,
+	LINKTYPE_ELEC_ARTICLE:       `Electronic on-line article (HTML)`,
+	LINKTYPE_FULL_ARTICLE:       `Full printable article (PDF)`,
+	LINKTYPE_GIF:                `Scanned article (GIF)`,
+	LINKTYPE_HEP:                `HEP/Spires information`,
+	LINKTYPE_ADDITIONAL_INFO:    `Additional information`,
+	LINKTYPE_LIBRARY_ENTRIES:    `Library entries`,
+	LINKTYPE_MULTIMEDIA:         `Multimedia`,
+	LINKTYPE_NED:                `NED objects`,
+	LINKTYPE_ASSOCIATED_ARTICLE: `Associated articles`,
+	LINKTYPE_PLANETARY_DATA:     `Planetary Data System`,
+	LINKTYPE_REFERENCES:         `References in the article`,
+	LINKTYPE_SIMBAD:             `SIMBAD objects`,
+	LINKTYPE_TABLE_OF_CONTENTS:  `Table of contents`,
+	LINKTYPE_ALSO_READ_ARTICLE:  `Also-read articles`,
+	LINKTYPE_ARXIV:              `arXiv e-print`,
+	LINKTYPE_ABSTRACT_CUSTOM:    `Custom abstract`,
+}
+
 type Paper interface {
 	String() string
 	GetBibTex() (string, error)
+	GetBibTexContext(context.Context) (string, error)
 	GetBibcode() string
 	SetBibcode(string)
 	GetURLOfType(string) string
@@ -42,9 +67,17 @@ type Paper interface {
 	SetTitle(string)
 	GetAuthors() string
 	SetAuthors(string)
+	GetAuthorList() []Person
+	SetAuthorList([]Person)
+	Metadata() *Metadata
 	GetAbstract() string
 	SetAbstract(string)
 	SetAbstractFromADS() error
+	SetAbstractFromADSContext(context.Context) error
+	Citations() ([]Paper, error)
+	CitationsContext(context.Context) ([]Paper, error)
+	References() ([]Paper, error)
+	ReferencesContext(context.Context) ([]Paper, error)
 	LinkTypes() string
 	LinkTypesIn(string) string
 	HasLink(string) bool
@@ -54,9 +87,10 @@ type Paper interface {
 type paper struct {
 	bibcode  string
 	title    string
-	authors  string
 	abstract string
 	links    map[string]string
+	meta     Metadata
+	client   Backend
 }
 
 func NewPaper() Paper {
@@ -88,17 +122,48 @@ func (p *paper) GetBibcode() string {
 
 func (p *paper) SetBibcode(bibcode string) {
 	p.bibcode = bibcode
+	p.meta.setFromBibcode(bibcode)
 }
 func (p *paper) GetBibTex() (string, error) {
-	return GetBibTex(p.bibcode)
+	return p.GetBibTexContext(context.Background())
 }
 
+func (p *paper) GetBibTexContext(ctx context.Context) (string, error) {
+	return p.backend().GetBibTexContext(ctx, p.bibcode)
+}
+
+// backend returns the client that produced the paper, or DefaultClient.
+func (p *paper) backend() Backend {
+	if p.client == nil {
+		return DefaultClient
+	}
+	return p.client
+}
+
+// GetAuthors returns the author list joined by semicolons, as in the
+// classic interface.
 func (p *paper) GetAuthors() string {
-	return p.authors
+	names := make([]string, len(p.meta.Authors))
+	for i, author := range p.meta.Authors {
+		names[i] = author.String()
+	}
+	return strings.Join(names, `; `)
 }
 
 func (p *paper) SetAuthors(authors string) {
-	p.authors = authors
+	p.meta.Authors = ParseAuthors(authors)
+}
+
+func (p *paper) GetAuthorList() []Person {
+	return p.meta.Authors
+}
+
+func (p *paper) SetAuthorList(authors []Person) {
+	p.meta.Authors = authors
+}
+
+func (p *paper) Metadata() *Metadata {
+	return &p.meta
 }
 
 func (p *paper) GetAbstract() string {
@@ -110,15 +175,40 @@ func (p *paper) SetAbstract(abstract string) {
 }
 
 func (p *paper) SetAbstractFromADS() error {
+	return p.SetAbstractFromADSContext(context.Background())
+}
+
+func (p *paper) SetAbstractFromADSContext(ctx context.Context) error {
+	if p.abstract != "" {
+		return nil
+	}
 	if p.HasLink(LINKTYPE_ABSTRACT) {
-		abs, err := GetAbstract(p.links[LINKTYPE_ABSTRACT])
+		abs, err := p.backend().GetAbstractContext(ctx, p.links[LINKTYPE_ABSTRACT])
 		if err != nil {
 			return err
 		}
 		p.abstract = abs
 		return nil
 	}
-	return fmt.Errorf(`this paper does not have linktype %s`, LINKTYPE_ABSTRACT)
+	return fmt.Errorf(`abstract of %s: %w (no linktype %s)`, p.bibcode, ErrNotFound, LINKTYPE_ABSTRACT)
+}
+
+// Citations returns the papers citing p.
+func (p *paper) Citations() ([]Paper, error) {
+	return p.CitationsContext(context.Background())
+}
+
+func (p *paper) CitationsContext(ctx context.Context) ([]Paper, error) {
+	return p.backend().GetLinkedPapersContext(ctx, p, LINKTYPE_CITATIONS)
+}
+
+// References returns the papers cited by p.
+func (p *paper) References() ([]Paper, error) {
+	return p.ReferencesContext(context.Background())
+}
+
+func (p *paper) ReferencesContext(ctx context.Context) ([]Paper, error) {
+	return p.backend().GetLinkedPapersContext(ctx, p, LINKTYPE_REFERENCES)
 }
 
 func (p *paper) GetTitle() string {
@@ -134,7 +224,7 @@ func (p *paper) SetURL(url, linktype string) error {
 		p.links[strings.ToUpper(linktype)] = url
 		return nil
 	}
-	return fmt.Errorf(`linktype must be a single character in %v`, VALID_LINKS)
+	return &FieldError{Field: `linktype`, Value: linktype, Reason: `must be a single character in ` + VALID_LINKS}
 }
 
 func (p *paper) LinkTypes() string {
@@ -159,24 +249,27 @@ func (p *paper) LinkTypesIn(linktypes string) string {
 	return _linktypes
 }
 
+// HasLink reports whether the paper has any of the given linktypes.
 func (p *paper) HasLink(linktypes string) bool {
 	for _, linktype := range linktypes {
-		if p.HasLink(string(linktype)) {
+		if p.hasLinkType(string(linktype)) {
 			return true
 		}
 	}
 	return false
 }
 
-func (p *paper) HasLinkAll(linktype string) bool {
-	linktype = strings.ToUpper(linktype)
-	if len(linktype) == 1 && strings.Contains(VALID_LINKS, linktype) {
-		if p.links[linktype] == "" {
+// HasLinkAll reports whether the paper has all of the given linktypes.
+func (p *paper) HasLinkAll(linktypes string) bool {
+	for _, linktype := range linktypes {
+		if !p.hasLinkType(string(linktype)) {
 			return false
-		} else {
-			return true
 		}
 	}
-	fmt.Println(`linktype must be a single character in %v`, VALID_LINKS)
-	return false
+	return linktypes != ""
+}
+
+func (p *paper) hasLinkType(linktype string) bool {
+	linktype = strings.ToUpper(linktype)
+	return len(linktype) == 1 && strings.Contains(VALID_LINKS, linktype) && p.links[linktype] != ""
 }
@@ -0,0 +1,335 @@
+package termads
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*=======================================================
+/*               Free-text query parser
+/*=======================================================*/
+
+// QuerySyntaxError reports the (1-based) column of the offending input.
+type QuerySyntaxError struct {
+	Query  string
+	Column int
+	Msg    string
+}
+
+func (err *QuerySyntaxError) Error() string {
+	return fmt.Sprintf(`column %d: %s`, err.Column, err.Msg)
+}
+
+// Pointer returns the query with a caret under the offending column.
+func (err *QuerySyntaxError) Pointer() string {
+	return err.Query + "\n" + strings.Repeat(` `, err.Column-1) + `^`
+}
+
+// Fields accepted by ParseQuery. Aliases map to the ADS field name.
+var queryFields = map[string]string{
+	`author`:       `author`,
+	`first_author`: `first_author`,
+	`title`:        `title`,
+	`abs`:          `abs`,
+	`abstract`:     `abs`,
+	`text`:         `abs`,
+	`keyword`:      `keyword`,
+	`full`:         `full`,
+	`year`:         `year`,
+	`pubdate`:      `pubdate`,
+	`bibstem`:      `bibstem`,
+	`bibcode`:      `bibcode`,
+	`doi`:          `doi`,
+	`arxiv`:        `arXiv`,
+	`aff`:          `aff`,
+	`orcid`:        `orcid`,
+	`property`:     `property`,
+	`object`:       `object`,
+	`identifier`:   `identifier`,
+}
+
+// Property values that ADS spells differently.
+var propertyAliases = map[string]string{
+	`nonrefereed`: `notrefereed`,
+}
+
+const (
+	tokEOF = iota
+	tokWord
+	tokPhrase
+	tokField
+	tokLParen
+	tokRParen
+	tokNot
+	tokAnd
+	tokOr
+)
+
+type token struct {
+	kind int
+	text string
+	col  int
+}
+
+type queryParser struct {
+	query  string
+	tokens []token
+	pos    int
+}
+
+// ParseQuery parses a human query such as
+//
+//	author:"Kennicutt" year:1998-2005 title:"star formation" -property:nonrefereed
+//
+// Adjacent terms are joined by AND; OR, NOT, "-" and parentheses are supported.
+func ParseQuery(s string) (Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{query: s, tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), `empty query`)
+	}
+	q, err := p.parseOr(``)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, `unexpected "%s"`, tok.text)
+	}
+	return q, nil
+}
+
+func lexQuery(s string) ([]token, error) {
+	runes := []rune(s)
+	tokens := []token{}
+	afterField := false
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			if afterField {
+				return nil, &QuerySyntaxError{s, col, `missing value after field`}
+			}
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, `(`, col})
+			i++
+		case r == ')':
+			if afterField {
+				return nil, &QuerySyntaxError{s, col, `missing value after field`}
+			}
+			tokens = append(tokens, token{tokRParen, `)`, col})
+			i++
+		case r == '-' && !afterField && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{tokNot, `-`, col})
+			i++
+		case r == '"':
+			j := i + 1
+			text := []rune{}
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				text = append(text, runes[j])
+			}
+			if j >= len(runes) {
+				return nil, &QuerySyntaxError{s, col, `unterminated phrase`}
+			}
+			tokens = append(tokens, token{tokPhrase, string(text), col})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(runes); j++ {
+				c := runes[j]
+				if unicode.IsSpace(c) || c == '(' || c == ')' || c == '"' {
+					break
+				}
+				if c == ':' && !afterField {
+					break
+				}
+			}
+			word := string(runes[i:j])
+			if !afterField && j < len(runes) && runes[j] == ':' {
+				if word == `` {
+					return nil, &QuerySyntaxError{s, col, `missing field name before ":"`}
+				}
+				tokens = append(tokens, token{tokField, word, col})
+				i = j + 1
+				if i >= len(runes) {
+					return nil, &QuerySyntaxError{s, i + 1, `missing value after field`}
+				}
+				afterField = true
+				continue
+			}
+			kind := tokWord
+			if !afterField {
+				switch word {
+				case `AND`:
+					kind = tokAnd
+				case `OR`:
+					kind = tokOr
+				case `NOT`:
+					kind = tokNot
+				}
+			}
+			tokens = append(tokens, token{kind, word, col})
+			i = j
+		}
+		afterField = false
+	}
+	return append(tokens, token{tokEOF, ``, len(runes) + 1}), nil
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) errorf(tok token, format string, args ...interface{}) error {
+	return &QuerySyntaxError{Query: p.query, Column: tok.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) parseOr(field string) (Query, error) {
+	q, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	clauses := []Query{q}
+	for p.peek().kind == tokOr {
+		p.next()
+		q, err := p.parseAnd(field)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, q)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return Or(clauses...), nil
+}
+
+func (p *queryParser) parseAnd(field string) (Query, error) {
+	clauses := []Query{}
+	for {
+		tok := p.peek()
+		if tok.kind == tokEOF || tok.kind == tokRParen || tok.kind == tokOr {
+			break
+		}
+		if tok.kind == tokAnd {
+			if len(clauses) == 0 {
+				return nil, p.errorf(tok, `AND without left operand`)
+			}
+			p.next()
+		}
+		q, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, q)
+	}
+	switch len(clauses) {
+	case 0:
+		return nil, p.errorf(p.peek(), `expected a search term`)
+	case 1:
+		return clauses[0], nil
+	}
+	return And(clauses...), nil
+}
+
+func (p *queryParser) parseUnary(field string) (Query, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		q, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		return Not(q), nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *queryParser) parsePrimary(field string) (Query, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		q, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf(tok, `unclosed parenthesis`)
+		}
+		p.next()
+		return q, nil
+	case tokField:
+		if field != `` {
+			return nil, p.errorf(tok, `nested field "%s" inside %s:(...)`, tok.text, field)
+		}
+		name, ok := queryFields[strings.ToLower(tok.text)]
+		if !ok {
+			return nil, p.errorf(tok, `unknown field "%s"`, tok.text)
+		}
+		switch p.peek().kind {
+		case tokLParen, tokWord, tokPhrase:
+			return p.parsePrimary(name)
+		}
+		return nil, p.errorf(p.peek(), `missing value after field "%s"`, tok.text)
+	case tokPhrase:
+		if field == `year` {
+			return p.parseYear(tok)
+		}
+		return Phrase(field, tok.text), nil
+	case tokWord:
+		if field == `year` {
+			return p.parseYear(tok)
+		}
+		if alias, ok := propertyAliases[strings.ToLower(tok.text)]; ok && field == `property` {
+			return Field(field, alias), nil
+		}
+		return Field(field, tok.text), nil
+	case tokEOF:
+		return nil, p.errorf(tok, `unexpected end of query`)
+	}
+	return nil, p.errorf(tok, `unexpected "%s"`, tok.text)
+}
+
+// parseYear accepts YYYY, YYYY-YYYY, YYYY- and -YYYY.
+func (p *queryParser) parseYear(tok token) (Query, error) {
+	from, to := tok.text, tok.text
+	if k := strings.Index(tok.text, `-`); k >= 0 {
+		from, to = tok.text[:k], tok.text[k+1:]
+	}
+	years := [2]int{}
+	for i, s := range []string{from, to} {
+		if s == `` {
+			continue
+		}
+		year, err := strconv.Atoi(s)
+		if err != nil || len(s) != 4 {
+			col := tok.col
+			if i == 1 && from != to {
+				col += len(from) + 1
+			}
+			return nil, &QuerySyntaxError{p.query, col, fmt.Sprintf(`invalid year "%s"`, s)}
+		}
+		years[i] = year
+	}
+	if years[0] > 0 && years[1] > 0 && years[0] > years[1] {
+		return nil, p.errorf(tok, `year range %d-%d is reversed`, years[0], years[1])
+	}
+	return YearRange(years[0], years[1]), nil
+}
@@ -0,0 +1,127 @@
+package termads
+
+import (
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		// adjacent terms are joined by AND, which binds tighter than OR
+		{`a b`, `a AND b`},
+		{`a AND b`, `a AND b`},
+		{`a b OR c`, `(a AND b) OR c`},
+		{`a OR b c`, `a OR (b AND c)`},
+		{`(a OR b) c`, `(a OR b) AND c`},
+		{`a OR b OR c`, `a OR b OR c`},
+		{`((a))`, `a`},
+		// fields, aliases and grouped values
+		{`author:"Kennicutt, R." year:1998-2005`, `author:"Kennicutt, R." AND year:1998-2005`},
+		{`abstract:dust text:gas`, `abs:dust AND abs:gas`},
+		{`arxiv:1901.00001 doi:10.1086/305588`, `arXiv:1901.00001 AND doi:10.1086/305588`},
+		{`TITLE:dust`, `title:dust`},
+		{`title:(star formation)`, `title:star AND title:formation`},
+		{`title:(star OR dust) aff:"MPIA"`, `(title:star OR title:dust) AND aff:"MPIA"`},
+		// quoting
+		{`"star formation"`, `"star formation"`},
+		{`title:"a \"quoted\" word"`, `title:"a \"quoted\" word"`},
+		{`title:"x:y"`, `title:"x:y"`},
+		// year ranges
+		{`year:2001`, `year:2001`},
+		{`year:1998-`, `year:[1998 TO *]`},
+		{`year:-2005`, `year:[* TO 2005]`},
+		{`year:"1998-2005"`, `year:1998-2005`},
+		// negation
+		{`-property:nonrefereed`, `NOT property:notrefereed`},
+		{`property:NonRefereed`, `property:notrefereed`},
+		{`NOT a b`, `NOT a AND b`},
+		{`NOT (a OR b)`, `NOT (a OR b)`},
+		{`- a`, `- AND a`},
+		{`a -b`, `a AND NOT b`},
+		{`- -a`, `- AND NOT a`},
+		{`NOT -a`, `NOT NOT a`},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf(`ParseQuery(%q): %v`, tt.in, err)
+			continue
+		}
+		if got := q.String(); got != tt.want {
+			t.Errorf(`ParseQuery(%q) = %s, want %s`, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		in     string
+		column int
+		msg    string
+	}{
+		{``, 1, `empty query`},
+		{`   `, 4, `empty query`},
+		{`title: dust`, 7, `missing value after field`},
+		{`(title:)`, 8, `missing value after field`},
+		{`title:`, 7, `missing value after field`},
+		{`:dust`, 1, `missing field name before ":"`},
+		{`title:"star formation`, 7, `unterminated phrase`},
+		{`foo:bar`, 1, `unknown field "foo"`},
+		{`title:(author:x)`, 8, `nested field "author" inside title:(...)`},
+		{`a)`, 2, `unexpected ")"`},
+		{`AND a`, 1, `AND without left operand`},
+		{`a OR AND b`, 6, `AND without left operand`},
+		{`a OR`, 5, `expected a search term`},
+		{`()`, 2, `expected a search term`},
+		{`(a b`, 1, `unclosed parenthesis`},
+		{`NOT`, 4, `unexpected end of query`},
+		{`NOT )`, 5, `unexpected ")"`},
+		{`year:19x8`, 6, `invalid year "19x8"`},
+		{`year:98`, 6, `invalid year "98"`},
+		{`year:1998-20x0`, 11, `invalid year "20x0"`},
+		{`year:2005-1998`, 6, `year range 2005-1998 is reversed`},
+		// columns count characters, not bytes
+		{`title:Öpik foo:x`, 12, `unknown field "foo"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.in)
+		serr, ok := err.(*QuerySyntaxError)
+		if !ok {
+			t.Errorf(`ParseQuery(%q) = %v, want a *QuerySyntaxError`, tt.in, err)
+			continue
+		}
+		if serr.Column != tt.column || serr.Msg != tt.msg || serr.Query != tt.in {
+			t.Errorf(`ParseQuery(%q): %v, want column %d: %s`, tt.in, err, tt.column, tt.msg)
+		}
+		if ExitCode(err) != EXIT_USAGE {
+			t.Errorf(`ParseQuery(%q): exit code %d, want %d`, tt.in, ExitCode(err), EXIT_USAGE)
+		}
+	}
+
+	_, err := ParseQuery(`author:x foo:bar`)
+	if want := "author:x foo:bar\n         ^"; err.(*QuerySyntaxError).Pointer() != want {
+		t.Errorf("Pointer() =\n%s\nwant\n%s", err.(*QuerySyntaxError).Pointer(), want)
+	}
+}
+
+// TestParseQueryRefereed checks the example of ParseQuery in both
+// interfaces: the API gets ADS's spelling, the classic form a filter.
+func TestParseQueryRefereed(t *testing.T) {
+	q, err := ParseQuery(`author:"Kennicutt" year:1998-2005 title:"star formation" -property:nonrefereed`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := NewForm()
+	form.SetAPIQuery(q)
+	if got, want := form.APIValues().Get(`q`), `author:"Kennicutt" AND year:1998-2005 AND title:"star formation" AND NOT property:notrefereed`; got != want {
+		t.Errorf(`q = %s, want %s`, got, want)
+	}
+	form, err = NewFormFromQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := form.values.Get(`jou_pick`); got != `NO` {
+		t.Errorf(`jou_pick = %q, want NO`, got)
+	}
+}
@@ -0,0 +1,197 @@
+package termads
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+/*=======================================================
+/*                 Text of PDFs
+/*=======================================================*/
+
+const PDFTOTEXT = `pdftotext`
+
+// ExtractPDFText returns the text of the PDF at path. It uses pdftotext
+// (poppler) when it is installed, and otherwise reads the text operators
+// of the compressed page streams itself, which is enough for the PDFs of
+// arXiv and most journals but not for scanned papers.
+func ExtractPDFText(path string) (string, error) {
+	if tool, err := exec.LookPath(PDFTOTEXT); err == nil {
+		out, err := exec.Command(tool, `-q`, `-enc`, `UTF-8`, path, `-`).Output()
+		if err == nil {
+			return string(out), nil
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ``, err
+	}
+	text := pdfText(data)
+	if strings.TrimSpace(text) == `` {
+		return ``, &ParseError{What: path, Msg: `no text found; the PDF may be scanned or use embedded font encodings (install ` + PDFTOTEXT + `)`}
+	}
+	return text, nil
+}
+
+var pdfStream = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\n?endstream`)
+
+// pdfText extracts the strings shown by the content streams of data.
+func pdfText(data []byte) string {
+	var b strings.Builder
+	for _, m := range pdfStream.FindAllSubmatchIndex(data, -1) {
+		stream := data[m[2]:m[3]]
+		if r, err := zlib.NewReader(bytes.NewReader(stream)); err == nil {
+			// a truncated stream still gives what was decompressed
+			stream, _ = ioutil.ReadAll(r)
+		}
+		if bytes.Contains(stream, []byte(`BT`)) {
+			contentText(&b, stream)
+		}
+	}
+	return b.String()
+}
+
+// contentText writes the text of the BT ... ET blocks of a content stream:
+// the (strings) of Tj, TJ, ' and ", with spaces for wide TJ kerning and
+// newlines for line moves.
+func contentText(b *strings.Builder, s []byte) {
+	inText := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '(' && inText:
+			var str []byte
+			str, i = literalString(s, i)
+			b.Write(printable(str))
+		case c == '<' && inText && i+1 < len(s) && s[i+1] != '<':
+			end := bytes.IndexByte(s[i:], '>')
+			if end < 0 {
+				return
+			}
+			b.Write(printable(hexString(s[i+1 : i+end])))
+			i += end
+		case c == '-' && inText && i > 0 && (s[i-1] == ' ' || s[i-1] == '[' || s[i-1] == ')' || s[i-1] == '>'):
+			// kerning inside TJ: a large negative number is a word gap
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if j-i > 3 {
+				b.WriteByte(' ')
+			}
+			i = j - 1
+		case c == '%':
+			for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+				i++
+			}
+		case isOperator(s, i, `BT`):
+			inText = true
+			i++
+		case isOperator(s, i, `ET`):
+			inText = false
+			b.WriteByte('\n')
+			i++
+		case inText && (isOperator(s, i, `Td`) || isOperator(s, i, `TD`) || isOperator(s, i, `T*`)):
+			b.WriteByte('\n')
+			i++
+		case inText && (c == '\'' || c == '"') && isOperator(s, i, string(c)):
+			b.WriteByte('\n')
+		}
+	}
+}
+
+// isOperator reports whether the operator op stands alone at s[i:].
+func isOperator(s []byte, i int, op string) bool {
+	if !bytes.HasPrefix(s[i:], []byte(op)) {
+		return false
+	}
+	delim := func(j int) bool {
+		return j < 0 || j >= len(s) || strings.IndexByte(" \t\r\n[]()<>/", s[j]) >= 0
+	}
+	return delim(i-1) && delim(i+len(op))
+}
+
+// literalString reads the (string) starting at s[i] and returns it with
+// the index of its closing parenthesis.
+func literalString(s []byte, i int) ([]byte, int) {
+	str := []byte{}
+	depth := 0
+	for i++; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case 'n', 'r', 't':
+				str = append(str, ' ')
+			case '\n', '\r':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for k := 0; k < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; k++ {
+						n = n*8 + int(s[i]-'0')
+						i++
+					}
+					i--
+					str = append(str, byte(n))
+				} else {
+					str = append(str, e)
+				}
+			}
+		case c == '(':
+			depth++
+			str = append(str, c)
+		case c == ')':
+			if depth == 0 {
+				return str, i
+			}
+			depth--
+			str = append(str, c)
+		default:
+			str = append(str, c)
+		}
+	}
+	return str, i
+}
+
+func hexString(h []byte) []byte {
+	digits := []byte{}
+	for _, c := range h {
+		if strings.IndexByte(`0123456789abcdefABCDEF`, c) >= 0 {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	str := make([]byte, len(digits)/2)
+	for i := range str {
+		str[i] = unhex(digits[2*i])<<4 | unhex(digits[2*i+1])
+	}
+	return str
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// printable drops strings in font encodings that are not ASCII, such as
+// the two-byte glyph ids of CID fonts, which would only add noise.
+func printable(str []byte) []byte {
+	for _, c := range str {
+		if (c < 0x20 || c > 0x7e) && c != '\t' {
+			return nil
+		}
+	}
+	return str
+}
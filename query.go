@@ -0,0 +1,400 @@
+package termads
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*=======================================================
+/*                    Query
+/*=======================================================*/
+
+// Query is a node of a structured ADS search. String renders it in the
+// ADS query language.
+type Query interface {
+	String() string
+}
+
+// Term matches a single value of a field. An empty Field searches the
+// default fields.
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool
+}
+
+// Range matches From..To (inclusive) of a field. An empty bound is open.
+type Range struct {
+	Field string
+	From  string
+	To    string
+}
+
+// Bool joins clauses with AND or OR.
+type Bool struct {
+	Op      string
+	Clauses []Query
+}
+
+type Negation struct {
+	Query Query
+}
+
+// Group forces parentheses around a query.
+type Group struct {
+	Query Query
+}
+
+// Operator applies a second-order operator of ADS, e.g. citations(q).
+type Operator struct {
+	Name  string
+	Query Query
+}
+
+const (
+	OP_AND = `AND`
+	OP_OR  = `OR`
+)
+
+func Field(field, value string) Query {
+	return &Term{Field: field, Value: value}
+}
+
+func Phrase(field, value string) Query {
+	return &Term{Field: field, Value: value, Phrase: true}
+}
+
+func Author(name string) Query {
+	return Phrase(`author`, name)
+}
+
+func FirstAuthor(name string) Query {
+	return Phrase(`author`, `^`+name)
+}
+
+func Title(text string) Query {
+	return Field(`title`, text)
+}
+
+func Abstract(text string) Query {
+	return Field(`abs`, text)
+}
+
+func Year(year int) Query {
+	return YearRange(year, year)
+}
+
+// YearRange matches years between from and to. Zero leaves a bound open.
+func YearRange(from, to int) Query {
+	r := &Range{Field: `year`}
+	if from > 0 {
+		r.From = strconv.Itoa(from)
+	}
+	if to > 0 {
+		r.To = strconv.Itoa(to)
+	}
+	return r
+}
+
+func Bibstem(bibstem string) Query {
+	return Field(`bibstem`, bibstem)
+}
+
+func DOI(doi string) Query {
+	return Phrase(`doi`, doi)
+}
+
+func ArXiv(id string) Query {
+	return Phrase(`arXiv`, id)
+}
+
+func Aff(affiliation string) Query {
+	return Phrase(`aff`, affiliation)
+}
+
+func ORCID(orcid string) Query {
+	return Field(`orcid`, orcid)
+}
+
+func Property(property string) Query {
+	return Field(`property`, property)
+}
+
+func Refereed() Query {
+	return Property(`refereed`)
+}
+
+func And(clauses ...Query) Query {
+	return &Bool{Op: OP_AND, Clauses: clauses}
+}
+
+func Or(clauses ...Query) Query {
+	return &Bool{Op: OP_OR, Clauses: clauses}
+}
+
+func Not(q Query) Query {
+	return &Negation{Query: q}
+}
+
+func GroupOf(q Query) Query {
+	return &Group{Query: q}
+}
+
+// CitationsOf matches the papers citing the papers matched by q.
+func CitationsOf(q Query) Query {
+	return &Operator{Name: `citations`, Query: q}
+}
+
+// ReferencesOf matches the papers cited by the papers matched by q.
+func ReferencesOf(q Query) Query {
+	return &Operator{Name: `references`, Query: q}
+}
+
+func (t *Term) String() string {
+	value := t.Value
+	if t.Phrase || strings.ContainsAny(value, " \t:()\"") {
+		value = `"` + strings.Replace(value, `"`, `\"`, -1) + `"`
+	}
+	if t.Field == `` {
+		return value
+	}
+	return t.Field + `:` + value
+}
+
+func (r *Range) String() string {
+	from, to := r.From, r.To
+	if from == `` {
+		from = `*`
+	}
+	if to == `` {
+		to = `*`
+	}
+	if r.Field == `year` && from != `*` && to != `*` {
+		if from == to {
+			return `year:` + from
+		}
+		return `year:` + from + `-` + to
+	}
+	return fmt.Sprintf(`%s:[%s TO %s]`, r.Field, from, to)
+}
+
+func (b *Bool) String() string {
+	clauses := make([]string, 0, len(b.Clauses))
+	for _, clause := range b.Clauses {
+		if inner, ok := clause.(*Bool); ok && inner.Op != b.Op && len(inner.Clauses) > 1 {
+			clauses = append(clauses, `(`+inner.String()+`)`)
+		} else {
+			clauses = append(clauses, clause.String())
+		}
+	}
+	return strings.Join(clauses, ` `+b.Op+` `)
+}
+
+func (n *Negation) String() string {
+	if inner, ok := n.Query.(*Bool); ok && len(inner.Clauses) > 1 {
+		return `NOT (` + inner.String() + `)`
+	}
+	return `NOT ` + n.Query.String()
+}
+
+func (g *Group) String() string {
+	return `(` + g.Query.String() + `)`
+}
+
+func (o *Operator) String() string {
+	return o.Name + `(` + o.Query.String() + `)`
+}
+
+/*=======================================================
+/*              Query -> legacy Form
+/*=======================================================*/
+
+// Field names of the legacy form, keyed by the ADS field they accept.
+var legacyFields = map[string]string{
+	`author`:   `author`,
+	`title`:    `title`,
+	`abs`:      `text`,
+	`abstract`: `text`,
+	`object`:   `object`,
+}
+
+type legacyField struct {
+	terms []string
+	logic string
+}
+
+type lowering struct {
+	fields    map[string]*legacyField
+	startYear string
+	endYear   string
+	hasYear   bool
+	stems     []string
+	jouPick   string
+}
+
+// NewFormFromQuery builds a legacy Form from q.
+func NewFormFromQuery(q Query) (*Form, error) {
+	form := NewForm()
+	if err := form.SetQuery(q); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+// SetQuery lowers q into the legacy form fields. It returns an error for
+// constructs that the classic interface cannot express.
+func (form *Form) SetQuery(q Query) error {
+	l := &lowering{fields: map[string]*legacyField{}}
+	if err := l.and(q); err != nil {
+		return err
+	}
+	for key, field := range l.fields {
+		sep := ` `
+		if key == `author` || key == `object` {
+			sep = `; `
+		}
+		form.Set(key, strings.Join(field.terms, sep))
+		if field.logic != `` {
+			form.SetSearchLogic(key, field.logic)
+		}
+	}
+	if l.hasYear {
+		form.Set(`start_year`, l.startYear)
+		form.Set(`end_year`, l.endYear)
+	}
+	if len(l.stems) > 0 {
+		form.Set(`ref_stems`, strings.Join(l.stems, `,`))
+	}
+	if l.jouPick != `` {
+		form.Set(`jou_pick`, l.jouPick)
+	}
+	return nil
+}
+
+// SetAPIQuery attaches q to the form as is. Only the JSON API understands
+// it; the classic interface refuses such forms.
+func (form *Form) SetAPIQuery(q Query) {
+	form.query = q
+}
+
+func unsupported(q Query, reason string) error {
+	return &FieldError{Field: `query`, Value: q.String(), Reason: `the legacy form cannot express it: ` + reason}
+}
+
+func (l *lowering) and(q Query) error {
+	switch q := q.(type) {
+	case *Group:
+		return l.and(q.Query)
+	case *Bool:
+		if q.Op == OP_AND {
+			for _, clause := range q.Clauses {
+				if err := l.and(clause); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return l.or(q)
+	case *Term:
+		return l.term(q, OP_AND)
+	case *Range:
+		if q.Field != `year` {
+			return unsupported(q, `only year ranges are supported`)
+		}
+		if l.hasYear {
+			return unsupported(q, `only one year range is supported`)
+		}
+		l.hasYear, l.startYear, l.endYear = true, q.From, q.To
+		return nil
+	case *Negation:
+		if t, ok := q.Query.(*Term); ok && t.Field == `property` {
+			switch strings.ToLower(t.Value) {
+			case `refereed`:
+				return l.setJouPick(q, `EXCL`)
+			case `notrefereed`, `nonrefereed`:
+				return l.setJouPick(q, `NO`)
+			}
+		}
+		return unsupported(q, `negation is not supported`)
+	}
+	return unsupported(q, `unknown query node`)
+}
+
+// or accepts a disjunction of terms on a single field.
+func (l *lowering) or(q *Bool) error {
+	field := ``
+	terms := []*Term{}
+	for _, clause := range q.Clauses {
+		if g, ok := clause.(*Group); ok {
+			clause = g.Query
+		}
+		t, ok := clause.(*Term)
+		if !ok {
+			return unsupported(q, `OR is only supported between terms of one field`)
+		}
+		if field != `` && field != t.Field {
+			return unsupported(q, `OR across different fields`)
+		}
+		field = t.Field
+		terms = append(terms, t)
+	}
+	if key, ok := legacyFields[field]; ok && l.fields[key] != nil {
+		return unsupported(q, fmt.Sprintf(`field "%s" is already used`, field))
+	}
+	for _, t := range terms {
+		if err := l.term(t, OP_OR); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *lowering) term(t *Term, op string) error {
+	switch t.Field {
+	case `bibstem`:
+		if op == OP_AND && len(l.stems) > 0 {
+			return unsupported(t, `a paper has only one bibstem`)
+		}
+		l.stems = append(l.stems, t.Value)
+		return nil
+	case `property`:
+		switch strings.ToLower(t.Value) {
+		case `refereed`:
+			return l.setJouPick(t, `NO`)
+		case `notrefereed`, `nonrefereed`:
+			return l.setJouPick(t, `EXCL`)
+		}
+		return unsupported(t, `only property:refereed is supported`)
+	}
+	key, ok := legacyFields[t.Field]
+	if !ok {
+		return unsupported(t, fmt.Sprintf(`field "%s" is not available`, t.Field))
+	}
+	if strings.HasPrefix(t.Value, `^`) {
+		return unsupported(t, `first-author search is not available`)
+	}
+	value := t.Value
+	if t.Phrase && key != `author` && key != `object` {
+		value = `"` + value + `"`
+	}
+	field, ok := l.fields[key]
+	if !ok {
+		field = &legacyField{}
+		l.fields[key] = field
+	}
+	if len(field.terms) > 0 && field.logic != op {
+		return unsupported(t, fmt.Sprintf(`cannot mix AND and OR in field "%s"`, t.Field))
+	}
+	field.logic = op
+	field.terms = append(field.terms, value)
+	return nil
+}
+
+func (l *lowering) setJouPick(q Query, pick string) error {
+	if l.jouPick != `` && l.jouPick != pick {
+		return unsupported(q, `conflicting refereed filters`)
+	}
+	l.jouPick = pick
+	return nil
+}
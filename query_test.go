@@ -0,0 +1,149 @@
+package termads
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQueryString(t *testing.T) {
+	tests := []struct {
+		q    Query
+		want string
+	}{
+		{Field(``, `dust`), `dust`},
+		{Title(`dust`), `title:dust`},
+		{Author(`Kennicutt, R.`), `author:"Kennicutt, R."`},
+		{FirstAuthor(`Kennicutt`), `author:"^Kennicutt"`},
+		{Title(`star formation`), `title:"star formation"`},
+		{Title(`a:b`), `title:"a:b"`},
+		{Title(`f(x)`), `title:"f(x)"`},
+		{Title(`say "hi"`), `title:"say \"hi\""`},
+		{Title("tab\tbed"), "title:\"tab\tbed\""},
+		{DOI(`10.1086/305588`), `doi:"10.1086/305588"`},
+		{Year(1998), `year:1998`},
+		{YearRange(1998, 2005), `year:1998-2005`},
+		{YearRange(1998, 0), `year:[1998 TO *]`},
+		{YearRange(0, 2005), `year:[* TO 2005]`},
+		{&Range{Field: `citation_count`, From: `10`, To: `100`}, `citation_count:[10 TO 100]`},
+		{And(Title(`a`), Title(`b`), Title(`c`)), `title:a AND title:b AND title:c`},
+		{Or(And(Title(`a`), Title(`b`)), Title(`c`)), `(title:a AND title:b) OR title:c`},
+		{And(Or(Title(`a`), Title(`b`)), Title(`c`)), `(title:a OR title:b) AND title:c`},
+		// a single clause or the same operator needs no parentheses
+		{And(Or(Title(`a`)), Title(`c`)), `title:a AND title:c`},
+		{And(And(Title(`a`), Title(`b`)), Title(`c`)), `title:a AND title:b AND title:c`},
+		{Not(Refereed()), `NOT property:refereed`},
+		{Not(Or(Title(`a`), Title(`b`))), `NOT (title:a OR title:b)`},
+		{Not(Not(Title(`a`))), `NOT NOT title:a`},
+		{GroupOf(Title(`a`)), `(title:a)`},
+		{And(GroupOf(Or(Title(`a`), Title(`b`))), Title(`c`)), `(title:a OR title:b) AND title:c`},
+		{CitationsOf(Author(`Kennicutt`)), `citations(author:"Kennicutt")`},
+		{ReferencesOf(And(Bibstem(`ApJ`), Year(1998))), `references(bibstem:ApJ AND year:1998)`},
+	}
+	for _, tt := range tests {
+		if got := tt.q.String(); got != tt.want {
+			t.Errorf(`String() = %s, want %s`, got, tt.want)
+		}
+	}
+}
+
+func TestNewFormFromQuery(t *testing.T) {
+	q := And(
+		Author(`Kennicutt, R.`),
+		Author(`Evans, N.`),
+		Or(Title(`star`), Title(`dust`)),
+		Abstract(`Schmidt law`),
+		Phrase(`abs`, `star formation`),
+		YearRange(1998, 2005),
+		Or(Bibstem(`ApJ`), Bibstem(`MNRAS`)),
+		Refereed(),
+	)
+	form, err := NewFormFromQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []struct{ key, want string }{
+		{`author`, `Kennicutt, R.; Evans, N.`},
+		{`aut_logic`, `AND`},
+		{`title`, `star dust`},
+		{`ttl_logic`, `OR`},
+		{`text`, `Schmidt law "star formation"`},
+		{`txt_logic`, `AND`},
+		{`start_year`, `1998`},
+		{`end_year`, `2005`},
+		{`ref_stems`, `ApJ,MNRAS`},
+		{`jou_pick`, `NO`},
+	}
+	for _, v := range values {
+		if got := form.values.Get(v.key); got != v.want {
+			t.Errorf(`%s = %q, want %q`, v.key, got, v.want)
+		}
+	}
+
+	// the property filters, negated or not
+	picks := []struct {
+		q    Query
+		want string
+	}{
+		{Refereed(), `NO`},
+		{Not(Refereed()), `EXCL`},
+		{Property(`notrefereed`), `EXCL`},
+		{Property(`nonrefereed`), `EXCL`},
+		{Not(Property(`notrefereed`)), `NO`},
+		{And(Refereed(), Not(Property(`NotRefereed`))), `NO`},
+		{GroupOf(Refereed()), `NO`},
+	}
+	for _, p := range picks {
+		form, err := NewFormFromQuery(p.q)
+		if err != nil {
+			t.Errorf(`NewFormFromQuery(%s): %v`, p.q, err)
+			continue
+		}
+		if got := form.values.Get(`jou_pick`); got != p.want {
+			t.Errorf(`NewFormFromQuery(%s): jou_pick = %q, want %q`, p.q, got, p.want)
+		}
+	}
+
+	// open year ranges leave a year empty
+	form, err = NewFormFromQuery(YearRange(0, 2005))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.values.Get(`start_year`) != `` || form.values.Get(`end_year`) != `2005` {
+		t.Errorf(`years = %q-%q, want -2005`, form.values.Get(`start_year`), form.values.Get(`end_year`))
+	}
+}
+
+func TestNewFormFromQueryErrors(t *testing.T) {
+	tests := []struct {
+		q      Query
+		reason string
+	}{
+		{&Range{Field: `citation_count`, From: `10`}, `only year ranges are supported`},
+		{And(Year(1998), Year(2005)), `only one year range is supported`},
+		{Not(Title(`dust`)), `negation is not supported`},
+		{Not(Property(`openaccess`)), `negation is not supported`},
+		{CitationsOf(Title(`dust`)), `unknown query node`},
+		{Or(Title(`a`), And(Title(`b`), Title(`c`))), `OR is only supported between terms of one field`},
+		{Or(Title(`a`), Abstract(`b`)), `OR across different fields`},
+		{And(Title(`a`), Or(Title(`b`), Title(`c`))), `field "title" is already used`},
+		{And(Bibstem(`ApJ`), Bibstem(`MNRAS`)), `a paper has only one bibstem`},
+		{Property(`openaccess`), `only property:refereed is supported`},
+		{DOI(`10.1086/305588`), `field "doi" is not available`},
+		{Field(``, `dust`), `field "" is not available`},
+		{FirstAuthor(`Kennicutt`), `first-author search is not available`},
+		{And(Or(Title(`a`), Title(`b`)), Title(`c`)), `cannot mix AND and OR in field "title"`},
+		{And(Refereed(), Property(`notrefereed`)), `conflicting refereed filters`},
+	}
+	for _, tt := range tests {
+		form, err := NewFormFromQuery(tt.q)
+		var ferr *FieldError
+		if form != nil || !errors.As(err, &ferr) || !errors.Is(err, ErrInvalidField) {
+			t.Errorf(`NewFormFromQuery(%s) = %v, %v; want a FieldError`, tt.q, form, err)
+			continue
+		}
+		if !strings.HasSuffix(ferr.Reason, `: `+tt.reason) {
+			t.Errorf(`NewFormFromQuery(%s): %q, want %q`, tt.q, ferr.Reason, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package termads
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*=======================================================
+/*                 Rate limiting
+/*=======================================================*/
+
+const (
+	DEFAULT_RATE_LIMIT float64 = 5 // requests per second
+	DEFAULT_RATE_BURST int     = 5
+)
+
+// RateLimiter is a token bucket shared by all requests of a client.
+type RateLimiter struct {
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows rate requests per second on average and bursts
+// of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Wait blocks until a request may be made or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	return sleep(ctx, wait)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*=======================================================
+/*                 Retries
+/*=======================================================*/
+
+// RetryPolicy retries requests that failed on the network or with 429
+// or 5xx, waiting BaseDelay*2^n with full jitter, or as long as the
+// server asks in Retry-After.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration // longer waits are not attempted
+}
+
+var DEFAULT_RETRY = RetryPolicy{MaxRetries: 4, BaseDelay: 500 * time.Millisecond, MaxDelay: time.Minute}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay returns how long to wait before retry number attempt (from 0),
+// and false if the wait would exceed MaxDelay.
+func (policy *RetryPolicy) delay(attempt int, res *http.Response) (time.Duration, bool) {
+	if res != nil {
+		if d, ok := parseRetryAfter(res.Header.Get(`Retry-After`)); ok {
+			return d, policy.MaxDelay <= 0 || d <= policy.MaxDelay
+		}
+	}
+	backoff := policy.BaseDelay << uint(attempt)
+	if policy.MaxDelay > 0 && (backoff > policy.MaxDelay || backoff <= 0) {
+		backoff = policy.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(backoff))), true
+}
+
+// parseRetryAfter reads delta-seconds or an HTTP date.
+func parseRetryAfter(s string) (time.Duration, bool) {
+	if s == `` {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(s); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+/*=======================================================
+/*                 Quota
+/*=======================================================*/
+
+// Quota is the state of the ADS API rate limit from the
+// X-RateLimit-* headers of the last response.
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Known reports whether ADS has sent quota headers yet.
+func (q Quota) Known() bool {
+	return q.Limit > 0
+}
+
+// Exhausted reports whether no requests are left before Reset.
+func (q Quota) Exhausted() bool {
+	return q.Known() && q.Remaining <= 0 && time.Now().Before(q.Reset)
+}
+
+func (q Quota) String() string {
+	if !q.Known() {
+		return `unknown`
+	}
+	return fmt.Sprintf(`%d/%d, reset %s`, q.Remaining, q.Limit, q.Reset.Local().Format(`Jan 2 15:04`))
+}
+
+type quotaTracker struct {
+	mu    sync.Mutex
+	quota Quota
+}
+
+func (t *quotaTracker) get() Quota {
+	if t == nil {
+		return Quota{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.quota
+}
+
+func (t *quotaTracker) update(header http.Header) {
+	limit, err := strconv.Atoi(header.Get(`X-RateLimit-Limit`))
+	if t == nil || err != nil {
+		return
+	}
+	q := Quota{Limit: limit}
+	q.Remaining, _ = strconv.Atoi(header.Get(`X-RateLimit-Remaining`))
+	if reset, err := strconv.ParseInt(header.Get(`X-RateLimit-Reset`), 10, 64); err == nil {
+		q.Reset = time.Unix(reset, 0)
+	}
+	t.mu.Lock()
+	t.quota = q
+	t.mu.Unlock()
+}
+
+// Quota returns the remaining ADS API quota as last reported by ADS.
+func (client *Client) Quota() Quota {
+	return client.quota.get()
+}
+
+/*=======================================================
+/*                 Sending requests
+/*=======================================================*/
+
+// isAPI reports whether req goes to the ADS API, whose quota the client
+// tracks. PDFs from arXiv and publishers do not count against it.
+func (client *Client) isAPI(req *http.Request) bool {
+	for _, _url := range []string{client.APIURL, client.ExportURL} {
+		if u, err := url.Parse(_url); err == nil && u.Host != `` && u.Host == req.URL.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// send makes the request, waiting for the rate limiter and retrying
+// according to client.Retry.
+func (client *Client) send(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	api := client.isAPI(req)
+	if q := client.Quota(); api && client.Token != `` && q.Exhausted() {
+		return nil, fmt.Errorf(`%w: ADS API quota exhausted until %s`, ErrRateLimited, q.Reset.Local().Format(`Jan 2 15:04`))
+	}
+	for attempt := 0; ; attempt++ {
+		if err := client.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		res, err := httpClient.Do(req)
+		if res != nil && api {
+			client.quota.update(res.Header)
+		}
+		if ctx.Err() != nil || client.Retry == nil || attempt >= client.Retry.MaxRetries || !retryable(res, err) {
+			return res, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+		wait, ok := client.Retry.delay(attempt, res)
+		if !ok {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package termads
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer answers with the statuses in turn, then 200, and counts
+// the requests.
+func statusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	count := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(count, 1))
+		if body, _ := ioutil.ReadAll(r.Body); r.Method == `POST` && string(body) != `q=dust` {
+			t.Errorf(`attempt %d: body = %q`, n, body)
+		}
+		for key, vals := range header {
+			w.Header()[key] = vals
+		}
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte(`ok`))
+	}))
+	t.Cleanup(server.Close)
+	return server, count
+}
+
+func retryClient() *Client {
+	client := NewClient()
+	client.Limiter = nil
+	client.Retry = &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+	return client
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		status   int
+		requests int32
+	}{
+		{`success`, nil, 200, 1},
+		{`server errors`, []int{503, 500, 502}, 200, 4},
+		{`too many requests`, []int{429}, 200, 2},
+		{`out of retries`, []int{503, 503, 503, 504}, 504, 4},
+		{`not retryable`, []int{404, 503}, 404, 1},
+	}
+	for _, tt := range tests {
+		server, count := statusServer(t, nil, tt.statuses...)
+		// the body of a POST is sent again on every attempt
+		res, err := retryClient().postForm(context.Background(), server.URL, url.Values{`q`: {`dust`}})
+		if err != nil {
+			t.Errorf(`%s: %v`, tt.name, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status || *count != tt.requests {
+			t.Errorf(`%s: status %d after %d requests, want %d after %d`, tt.name, res.StatusCode, *count, tt.status, tt.requests)
+		}
+	}
+
+	// without a policy nothing is retried
+	server, count := statusServer(t, nil, 503)
+	client := retryClient()
+	client.Retry = nil
+	res, err := client.get(context.Background(), server.URL)
+	if err != nil || res.StatusCode != 503 || *count != 1 {
+		t.Errorf(`without retries: %v, %v after %d requests`, res, err, *count)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	// the server asks for longer than the client is willing to wait
+	server, count := statusServer(t, http.Header{`Retry-After`: {`120`}}, 429, 429)
+	start := time.Now()
+	res, err := retryClient().get(context.Background(), server.URL)
+	if err != nil || res.StatusCode != 429 || *count != 1 || time.Since(start) > time.Second {
+		t.Errorf(`Retry-After 120: %v, %v after %d requests`, res, err, *count)
+	}
+
+	server, count = statusServer(t, http.Header{`Retry-After`: {`0`}}, 429)
+	res, err = retryClient().get(context.Background(), server.URL)
+	if err != nil || res.StatusCode != 200 || *count != 2 {
+		t.Errorf(`Retry-After 0: %v, %v after %d requests`, res, err, *count)
+	}
+
+	// a wait is cut short by the context
+	server, _ = statusServer(t, http.Header{`Retry-After`: {`1`}}, 503)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := retryClient().get(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf(`cancelled retry: err = %v`, err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{``, 0, false},
+		{`0`, 0, true},
+		{`30`, 30 * time.Second, true},
+		{`-1`, 0, false},
+		{`soon`, 0, false},
+		{`Wed, 21 Oct 2015 07:28:00 GMT`, 0, true},
+	}
+	for _, tt := range tests {
+		if got, ok := parseRetryAfter(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf(`parseRetryAfter(%q) = %v, %v; want %v, %v`, tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got, ok := parseRetryAfter(date); !ok || got < 59*time.Minute || got > time.Hour {
+		t.Errorf(`parseRetryAfter(%q) = %v, %v; want an hour`, date, got, ok)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &RetryPolicy{MaxRetries: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 0; attempt < 8; attempt++ {
+		max := policy.BaseDelay << uint(attempt)
+		if max > policy.MaxDelay {
+			max = policy.MaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			if d, ok := policy.delay(attempt, nil); !ok || d < 0 || d >= max {
+				t.Fatalf(`delay(%d) = %v, %v; want below %v`, attempt, d, ok, max)
+			}
+		}
+	}
+	res := &http.Response{Header: http.Header{`Retry-After`: {`2`}}}
+	if d, ok := policy.delay(0, res); d != 2*time.Second || ok {
+		t.Errorf(`delay with Retry-After 2 = %v, %v; want 2s, false`, d, ok)
+	}
+	res.Header.Set(`Retry-After`, `1`)
+	if d, ok := policy.delay(5, res); d != time.Second || !ok {
+		t.Errorf(`delay with Retry-After 1 = %v, %v; want 1s, true`, d, ok)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	header := http.Header{
+		`X-Ratelimit-Limit`:     {`5000`},
+		`X-Ratelimit-Remaining`: {`0`},
+		`X-Ratelimit-Reset`:     {strconv.FormatInt(reset, 10)},
+	}
+	api, apiCount := statusServer(t, header)
+	// other sites may send the same headers for their own limits
+	pdfs, pdfCount := statusServer(t, http.Header{`X-Ratelimit-Limit`: {`10`}, `X-Ratelimit-Remaining`: {`0`}})
+
+	client := retryClient()
+	client.Token = `test-token`
+	client.APIURL = api.URL + `/v1/search/query`
+	if q := client.Quota(); q.Known() || q.Exhausted() || q.String() != `unknown` {
+		t.Errorf(`initial quota = %+v`, q)
+	}
+
+	res, err := client.getFrom(context.Background(), pdfs.URL+`/paper.pdf`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if client.Quota().Known() {
+		t.Errorf(`quota from another site = %+v`, client.Quota())
+	}
+
+	res, err = client.get(context.Background(), client.APIURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	q := client.Quota()
+	if q.Limit != 5000 || q.Remaining != 0 || q.Reset.Unix() != reset || !q.Exhausted() {
+		t.Errorf(`quota = %+v`, q)
+	}
+
+	// the API is not asked again until the reset
+	if _, err := client.get(context.Background(), client.APIURL); !errors.Is(err, ErrRateLimited) || *apiCount != 1 {
+		t.Errorf(`exhausted quota: err = %v after %d requests`, err, *apiCount)
+	}
+	// but PDFs can still be downloaded
+	res, err = client.getFrom(context.Background(), pdfs.URL+`/paper.pdf`, 0)
+	if err != nil || res.StatusCode != 200 || *pdfCount != 2 {
+		t.Errorf(`PDF with an exhausted quota: %v, %v after %d requests`, res, err, *pdfCount)
+	} else {
+		res.Body.Close()
+	}
+	// and the classic interface has no quota
+	client.Token = ``
+	res, err = client.get(context.Background(), client.APIURL)
+	if err != nil {
+		t.Errorf(`without a token: %v`, err)
+	} else {
+		res.Body.Close()
+	}
+
+	if q := (Quota{Limit: 10, Remaining: 0, Reset: time.Now().Add(-time.Minute)}); q.Exhausted() {
+		t.Errorf(`quota past its reset is exhausted: %+v`, q)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(50, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// two requests of the burst, then one every 20ms
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf(`4 requests took %v, want at least 40ms`, elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); err != context.Canceled {
+		t.Errorf(`Wait with a cancelled context = %v`, err)
+	}
+	var none *RateLimiter
+	if err := none.Wait(context.Background()); err != nil {
+		t.Errorf(`nil limiter: %v`, err)
+	}
+}
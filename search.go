@@ -0,0 +1,186 @@
+package termads
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	DEFAULT_RESULT_LIMIT int = 1000
+)
+
+/*=======================================================
+/*                 Paged search
+/*=======================================================*/
+
+// ResultIterator walks over all hits of a search, requesting the next
+// start_nr window from ADS whenever the current one is exhausted.
+//
+//	it := client.Search(form)
+//	for it.Next() {
+//		paper := it.Paper()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type ResultIterator struct {
+	ctx      context.Context
+	backend  Backend
+	form     *Form
+	start    int
+	pageSize int
+	limit    int
+	total    int
+	count    int
+	buf      []Paper
+	current  Paper
+	err      error
+	warnings []*ParseError
+	done     bool
+}
+
+func (client *Client) Search(form *Form) *ResultIterator {
+	return newResultIterator(context.Background(), client, form)
+}
+
+// SearchContext is Search with every request made under ctx; once ctx is
+// done the iterator stops with ctx.Err().
+func (client *Client) SearchContext(ctx context.Context, form *Form) *ResultIterator {
+	return newResultIterator(ctx, client, form)
+}
+
+func Search(form *Form) *ResultIterator {
+	return DefaultClient.Search(form)
+}
+
+func SearchContext(ctx context.Context, form *Form) *ResultIterator {
+	return DefaultClient.SearchContext(ctx, form)
+}
+
+func newResultIterator(ctx context.Context, backend Backend, form *Form) *ResultIterator {
+	form = form.Copy()
+	start, rows := form.Page()
+	if start < 1 {
+		start = 1
+	}
+	if rows < 1 {
+		rows = 200
+	}
+	return &ResultIterator{
+		ctx:      ctx,
+		backend:  backend,
+		form:     form,
+		start:    start,
+		pageSize: rows,
+		limit:    DEFAULT_RESULT_LIMIT,
+		total:    -1,
+	}
+}
+
+// SetLimit sets the maximum number of papers returned. n <= 0 removes
+// the bound.
+func (it *ResultIterator) SetLimit(n int) {
+	it.limit = n
+}
+
+// SetPageSize sets the number of papers requested at once.
+func (it *ResultIterator) SetPageSize(n int) {
+	if n > 0 {
+		it.pageSize = n
+	}
+}
+
+// Total returns the number of hits reported by ADS, or -1 before the
+// first request or when ADS does not report it.
+func (it *ResultIterator) Total() int {
+	return it.total
+}
+
+// Count returns the number of papers returned so far.
+func (it *ResultIterator) Count() int {
+	return it.count
+}
+
+func (it *ResultIterator) Err() error {
+	return it.err
+}
+
+// Warnings returns the records of the pages read so far that could not be
+// parsed completely (see ResultPageError).
+func (it *ResultIterator) Warnings() []*ParseError {
+	return it.warnings
+}
+
+func (it *ResultIterator) Paper() Paper {
+	return it.current
+}
+
+// Next advances to the next paper, fetching a new page if necessary.
+func (it *ResultIterator) Next() bool {
+	if it.limit > 0 && it.count >= it.limit {
+		return false
+	}
+	for len(it.buf) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.current, it.buf = it.buf[0], it.buf[1:]
+	it.count++
+	return true
+}
+
+// NextPage returns up to one page of papers, or nil at the end.
+func (it *ResultIterator) NextPage() ([]Paper, error) {
+	papers := []Paper{}
+	for len(papers) < it.pageSize && it.Next() {
+		papers = append(papers, it.Paper())
+	}
+	if len(papers) == 0 {
+		return nil, it.err
+	}
+	return papers, nil
+}
+
+// All collects every remaining paper up to the limit.
+func (it *ResultIterator) All() ([]Paper, error) {
+	papers := []Paper{}
+	for it.Next() {
+		papers = append(papers, it.Paper())
+	}
+	return papers, it.err
+}
+
+func (it *ResultIterator) fetch() {
+	rows := it.pageSize
+	if it.limit > 0 && it.limit-it.count < rows {
+		rows = it.limit - it.count
+	}
+	it.form.SetPage(it.start, rows)
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return
+	}
+	papers, total, err := it.backend.GetPageContext(it.ctx, it.form)
+	records := len(papers)
+	var perr *ResultPageError
+	if errors.As(err, &perr) {
+		// broken records are skipped, not fatal
+		it.warnings = append(it.warnings, perr.Warnings...)
+		records = perr.Records
+	} else if err != nil {
+		it.err = err
+		return
+	}
+	if total >= 0 {
+		it.total = total
+	}
+	for _, paper := range papers {
+		if paper != nil {
+			it.buf = append(it.buf, paper)
+		}
+	}
+	it.start += records
+	if records < rows || (it.total >= 0 && it.start > it.total) {
+		it.done = true
+	}
+}
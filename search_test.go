@@ -0,0 +1,196 @@
+package termads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// pagedBackend serves hits papers a page at a time and records the
+// windows requested.
+type pagedBackend struct {
+	hits        int
+	reportTotal bool
+	broken      int   // the hit that cannot be parsed, from 1; 0 for none
+	failAt      int   // the start that fails; 0 for none
+	pages       []int // start and rows of each request
+}
+
+func (b *pagedBackend) GetPageContext(ctx context.Context, form *Form) ([]Paper, int, error) {
+	start, rows := form.Page()
+	b.pages = append(b.pages, start, rows)
+	if start == b.failAt {
+		return nil, -1, &StatusError{Code: 500}
+	}
+	papers := []Paper{}
+	var warnings []*ParseError
+	for i := start; i < start+rows && i <= b.hits; i++ {
+		if i == b.broken {
+			papers = append(papers, nil)
+			warnings = append(warnings, &ParseError{What: `record`, Msg: `no bibcode`})
+			continue
+		}
+		p := NewPaper()
+		p.SetBibcode(fmt.Sprint(i))
+		papers = append(papers, p)
+	}
+	total := -1
+	if b.reportTotal {
+		total = b.hits
+	}
+	if warnings != nil {
+		return papers, total, &ResultPageError{Warnings: warnings, Records: len(papers)}
+	}
+	return papers, total, nil
+}
+
+func (b *pagedBackend) GetAbstractContext(ctx context.Context, _url string) (string, error) {
+	return ``, nil
+}
+
+func (b *pagedBackend) GetBibTexContext(ctx context.Context, bibcode string) (string, error) {
+	return ``, nil
+}
+
+func (b *pagedBackend) GetBibTexBatchContext(ctx context.Context, bibcodes []string) (map[string]string, []string, error) {
+	return nil, nil, nil
+}
+
+func (b *pagedBackend) GetLinkedPapersContext(ctx context.Context, p Paper, linktype string) ([]Paper, error) {
+	return nil, nil
+}
+
+func bibcodes(papers []Paper) []string {
+	codes := []string{}
+	for _, p := range papers {
+		codes = append(codes, p.GetBibcode())
+	}
+	return codes
+}
+
+func hitRange(from, to int) []string {
+	codes := []string{}
+	for i := from; i <= to; i++ {
+		codes = append(codes, fmt.Sprint(i))
+	}
+	return codes
+}
+
+func TestResultIterator(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend *pagedBackend
+		limit   int
+		want    []string
+		pages   []int
+		total   int
+	}{
+		{`across pages`, &pagedBackend{hits: 25, reportTotal: true}, 0,
+			hitRange(1, 25), []int{1, 10, 11, 10, 21, 10}, 25},
+		// the total tells that no further page is needed
+		{`ends on a page boundary`, &pagedBackend{hits: 20, reportTotal: true}, 0,
+			hitRange(1, 20), []int{1, 10, 11, 10}, 20},
+		{`limit`, &pagedBackend{hits: 100, reportTotal: true}, 25,
+			hitRange(1, 25), []int{1, 10, 11, 10, 21, 5}, 100},
+		{`limit on a page boundary`, &pagedBackend{hits: 100, reportTotal: true}, 20,
+			hitRange(1, 20), []int{1, 10, 11, 10}, 100},
+		{`fewer hits than the limit`, &pagedBackend{hits: 7, reportTotal: true}, 1000,
+			hitRange(1, 7), []int{1, 10}, 7},
+		{`unknown total`, &pagedBackend{hits: 23}, 0,
+			hitRange(1, 23), []int{1, 10, 11, 10, 21, 10}, -1},
+		// only an empty page tells the end
+		{`unknown total on a page boundary`, &pagedBackend{hits: 20}, 0,
+			hitRange(1, 20), []int{1, 10, 11, 10, 21, 10}, -1},
+		{`unknown total and a limit`, &pagedBackend{hits: 50}, 15,
+			hitRange(1, 15), []int{1, 10, 11, 5}, -1},
+		// broken records are skipped but counted in the window
+		{`broken record`, &pagedBackend{hits: 15, reportTotal: true, broken: 10}, 0,
+			append(hitRange(1, 9), hitRange(11, 15)...), []int{1, 10, 11, 10}, 15},
+		{`no hits`, &pagedBackend{reportTotal: true}, 0,
+			[]string{}, []int{1, 10}, 0},
+	}
+	for _, tt := range tests {
+		it := newResultIterator(context.Background(), tt.backend, NewForm())
+		it.SetPageSize(10)
+		it.SetLimit(tt.limit)
+		if it.Total() != -1 {
+			t.Errorf(`%s: Total() = %d before the first request`, tt.name, it.Total())
+		}
+		papers, err := it.All()
+		if err != nil {
+			t.Errorf(`%s: %v`, tt.name, err)
+		}
+		if got := bibcodes(papers); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf(`%s: papers %v, want %v`, tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(tt.backend.pages, tt.pages) {
+			t.Errorf(`%s: requested (start, rows) %v, want %v`, tt.name, tt.backend.pages, tt.pages)
+		}
+		if it.Total() != tt.total || it.Count() != len(tt.want) {
+			t.Errorf(`%s: Total() = %d, Count() = %d; want %d, %d`, tt.name, it.Total(), it.Count(), tt.total, len(tt.want))
+		}
+		// the end is final
+		if it.Next() || len(tt.backend.pages) != len(tt.pages) {
+			t.Errorf(`%s: Next() after the end requested %v`, tt.name, tt.backend.pages)
+		}
+		if tt.backend.broken > 0 && len(it.Warnings()) != 1 {
+			t.Errorf(`%s: warnings %v`, tt.name, it.Warnings())
+		}
+	}
+}
+
+func TestResultIteratorPages(t *testing.T) {
+	backend := &pagedBackend{hits: 25, reportTotal: true}
+	form := NewForm()
+	form.SetPage(6, 8)
+	it := newResultIterator(context.Background(), backend, form)
+	pages := [][]string{}
+	for {
+		page, err := it.NextPage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page == nil {
+			break
+		}
+		pages = append(pages, bibcodes(page))
+	}
+	// the page of the form is where the iterator starts
+	want := [][]string{hitRange(6, 13), hitRange(14, 21), hitRange(22, 25)}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf(`pages %v, want %v`, pages, want)
+	}
+	// and the form itself is left alone
+	if start, rows := form.Page(); start != 6 || rows != 8 {
+		t.Errorf(`the form was changed to %d, %d`, start, rows)
+	}
+}
+
+func TestResultIteratorErrors(t *testing.T) {
+	backend := &pagedBackend{hits: 25, reportTotal: true, failAt: 11}
+	it := newResultIterator(context.Background(), backend, NewForm())
+	it.SetPageSize(10)
+	papers, err := it.All()
+	if len(papers) != 10 || !errors.As(err, new(*StatusError)) || it.Err() != err {
+		t.Errorf(`All() = %d papers, %v`, len(papers), err)
+	}
+	if it.Next() || len(backend.pages) != 4 {
+		t.Errorf(`Next() after an error requested %v`, backend.pages)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend = &pagedBackend{hits: 25, reportTotal: true}
+	it = newResultIterator(ctx, backend, NewForm())
+	it.SetPageSize(10)
+	for it.Next() {
+		if it.Count() == 5 {
+			cancel()
+		}
+	}
+	if it.Err() != context.Canceled || it.Count() != 10 || len(backend.pages) != 2 {
+		t.Errorf(`cancelled: %v after %d papers and requests %v`, it.Err(), it.Count(), backend.pages)
+	}
+}